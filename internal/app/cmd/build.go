@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/Kalinin-Andrey/dbmigrator/pkg/dbmigrator"
+)
+
+var buildForce bool
+
+// buildCmd represents the build command
+var buildCmd = &cobra.Command{
+	Use:   "build",
+	Short: "Compiles migrations into the cached binary.",
+	Long: `Compiles migrations into the binary cached by a hash of their sources. The binary is reused by other commands while sources are not changed, so Go toolchain is not required to run them.`,
+	Annotations: map[string]string{
+		annotationOffline: "true",
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		binary, err := dbmigrator.Build(buildForce)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Println("binary: ", binary)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(buildCmd)
+
+	buildCmd.Flags().BoolVarP(&buildForce, "force", "f", false, "Rebuild the binary even if it is cached, e.g. after update of dependencies.")
+}
@@ -19,6 +19,9 @@ var createCmd = &cobra.Command{
 	Use:   "create",
 	Short: "Create a new migration.",
 	Long: `Create a new migration.`,
+	Annotations: map[string]string{
+		annotationOffline: "true",
+	},
 	Args: func(cmd *cobra.Command, args []string) error {
 		p := &api.MigrationCreateParams{
 			ID:		migrationID,
@@ -26,6 +29,9 @@ var createCmd = &cobra.Command{
 			Name:	migrationName,
 		}
 		cp := p.CoreParams()
+		if cp.ID == 0 {
+			return cp.ValidateDraft()
+		}
 		return cp.Validate()
 	},
 	Run: func(cmd *cobra.Command, args []string) {
@@ -45,16 +51,11 @@ var createCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(createCmd)
 
-	createCmd.Flags().UintVarP(&migrationID, "id", "i", 0, "ID of migration to be created. Must be uint type.")
+	createCmd.Flags().UintVarP(&migrationID, "id", "i", 0, "ID of migration to be created. Must be uint type. If not set, it is allocated according to the configured ID scheme.")
 	createCmd.Flags().StringVarP(&migrationType, "type", "t", "", "Type of migration to be created. Must be one of this: " + fmt.Sprintf("%v", api.MigrationTypes))
 	createCmd.Flags().StringVarP(&migrationName, "name", "n", "", "Name of migration to be created. Must be matches the specified regular expression: \"[a-zA-Z0-9_-]+\" ")
 
-	err := createCmd.MarkFlagRequired("id")
-	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
-	}
-	err = createCmd.MarkFlagRequired("type")
+	err := createCmd.MarkFlagRequired("type")
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
@@ -4,9 +4,11 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 
 	"github.com/Kalinin-Andrey/dbmigrator/pkg/dbmigrator"
+	"github.com/Kalinin-Andrey/dbmigrator/pkg/dbmigrator/api"
 )
 
 // dbversionCmd represents the dbversion command
@@ -14,9 +16,16 @@ var dbversionCmd = &cobra.Command{
 	Use:   "dbversion",
 	Short: "Outputs ID of last applied migration.",
 	Long: `Outputs ID of last applied migration.`,
+	Annotations: map[string]string{
+		annotationReadOnly: "true",
+	},
 	Run: func(cmd *cobra.Command, args []string) {
 		fmt.Println("dbversion called")
 		id, err := dbmigrator.DBVersion()
+		if errors.Is(err, api.ErrNoTable) {
+			fmt.Println("no history table")
+			return
+		}
 		if err != nil {
 			fmt.Println(err)
 			os.Exit(1)
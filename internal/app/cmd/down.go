@@ -19,7 +19,7 @@ var downCmd = &cobra.Command{
 		err := dbmigrator.Down(0)
 		if err != nil {
 			fmt.Println(err)
-			os.Exit(1)
+			os.Exit(exitCode(err))
 		}
 	},
 }
@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/Kalinin-Andrey/dbmigrator/pkg/dbmigrator"
+)
+
+// gotoCmd represents the goto command
+var gotoCmd = &cobra.Command{
+	Use:   "goto <id>",
+	Short: "Applies or reverts migrations to make the migration with the ID the last applied one.",
+	Long: `Applies or reverts migrations to make the migration with the ID the last applied one.
+ID 0 reverts all migrations.
+Goto is not atomic: later migrations are reverted and earlier ones are applied in separate runs,
+on a failure DB is left at the last applied migration that is printed in the error.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return errors.New("requires the ID of a migration")
+		}
+		if _, err := strconv.ParseUint(args[0], 10, 64); err != nil {
+			return errors.Errorf("invalid ID of a migration: %q", args[0])
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		id, _ := strconv.ParseUint(args[0], 10, 64)
+		err := dbmigrator.Goto(uint(id))
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(exitCode(err))
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(gotoCmd)
+}
@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/Kalinin-Andrey/dbmigrator/pkg/dbmigrator"
+)
+
+// graphCmd represents the graph command
+var graphCmd = &cobra.Command{
+	Use:   "graph",
+	Short: "Outputs the dependency graph of migrations in DOT format.",
+	Long: `Outputs the dependency graph of migrations in DOT format.
+Edges are directed from a dependency to a dependent migration, e.g.: dbmigrator graph | dot -Tsvg > migrations.svg`,
+	Annotations: map[string]string{
+		annotationOffline: "true",
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		err := dbmigrator.Graph(os.Stdout)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(graphCmd)
+}
@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/Kalinin-Andrey/dbmigrator/pkg/dbmigrator"
+)
+
+// planCmd represents the plan command
+var planCmd = &cobra.Command{
+	Use:   "plan",
+	Short: "Outputs migrations that are not applied yet in order of application.",
+	Long: `Outputs migrations that are not applied yet in order of application.`,
+	Annotations: map[string]string{
+		annotationReadOnly: "true",
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		ms, err := dbmigrator.Plan()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		if len(ms) == 0 {
+			fmt.Println("no pending migrations")
+			return
+		}
+
+		for _, m := range ms {
+			fmt.Printf("%6s %s\n", migrationLabel(m.ID), m.Name)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(planCmd)
+}
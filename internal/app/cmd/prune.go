@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/Kalinin-Andrey/dbmigrator/pkg/dbmigrator"
+)
+
+// pruneCmd represents the prune command
+var pruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Removes logs of applied migrations that are missing from code.",
+	Long: `Removes logs of applied migrations that are missing from code.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ms, err := dbmigrator.Prune()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		for _, m := range ms {
+			fmt.Printf("pruned: #%d %s\n", m.ID, m.Name)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(pruneCmd)
+}
@@ -19,7 +19,7 @@ var redoCmd = &cobra.Command{
 		err := dbmigrator.Redo()
 		if err != nil {
 			fmt.Println(err)
-			os.Exit(1)
+			os.Exit(exitCode(err))
 		}
 	},
 }
@@ -4,10 +4,12 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"time"
 
 	homedir "github.com/mitchellh/go-homedir"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"github.com/pkg/errors"
 
 	"github.com/Kalinin-Andrey/dbmigrator/pkg/dbmigrator"
 	"github.com/Kalinin-Andrey/dbmigrator/pkg/dbmigrator/api"
@@ -15,13 +17,28 @@ import (
 	//_ "github.com/Kalinin-Andrey/dbmigrator/migration"
 )
 
-var cfgFile, logFile, dsn, dir string
+var cfgFile, logFile, logFormat, logLevel, dsn, dir, outOfOrder, cacheDir, namespace, metricsTextfile string
+var dirs []string
+var ignoreMissing, disallowGaps bool
+var connectTimeout, retryInterval, retryBackoff time.Duration
+var maxAttempts, retryMaxAttempts int
+var retryClasses []string
 var ctx context.Context
 
+var config api.Configuration
+
+// annotationOffline is the annotation of commands that do not need a connection to DB
+const annotationOffline = "offline"
+// annotationReadOnly is the annotation of commands that do not change DB
+const annotationReadOnly = "readonly"
+
 var rootCmd = &cobra.Command{
 	Use:   "dbmigrator",
 	Short: "Go database migration tool and library supporting SQL or Go scripts.",
 	Long: `Go database migration tool and library supporting SQL or Go scripts.`,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		initSQLMigrator(cmd)
+	},
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
@@ -29,25 +46,57 @@ var rootCmd = &cobra.Command{
 func Execute(c context.Context) {
 	ctx = c
 
-	if err := rootCmd.ExecuteContext(ctx); err != nil {
+	if err := execute(); err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
 }
 
+// execute runs the root command and closes DBMigrator after it, the error of closing is ignored because DBMigrator is not initialised by some commands
+func execute() error {
+	defer dbmigrator.Close()
+
+	return rootCmd.ExecuteContext(ctx)
+}
+
 func init() {
-	cobra.OnInitialize(initSQLMigrator)
+	cobra.OnInitialize(initConfig)
 
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.dbmigrator.yaml)")
 	rootCmd.PersistentFlags().StringVar(&logFile, "log", "", "log file (default is stdout)")
+	rootCmd.PersistentFlags().StringVar(&logFormat, "log-format", "", "format of the log. Must be one of this: " + fmt.Sprintf("%v", api.LogFormats) + " (default is text)")
+	rootCmd.PersistentFlags().StringVar(&logLevel, "log-level", "", "minimal level of the log: debug, info, warn or error (default is info)")
 	rootCmd.PersistentFlags().StringVar(&dsn, "dsn", "", "dsn string for connection to DB")
 	rootCmd.PersistentFlags().StringVar(&dir, "dir", "", "path to directory with migrations")
+	rootCmd.PersistentFlags().StringVar(&namespace, "namespace", "", "namespace of migrations with an independent sequence of IDs (default is empty)")
+	rootCmd.PersistentFlags().StringSliceVar(&dirs, "dirs", nil, "paths to additional directories with SQL migrations")
+	rootCmd.PersistentFlags().StringVar(&cacheDir, "cache-dir", "", "path to directory for compiled migrations (default is the user's cache directory)")
+	rootCmd.PersistentFlags().StringVar(&metricsTextfile, "metrics-textfile", "", "path to a file for metrics of migrations in the Prometheus text format for the textfile collector of node_exporter")
+	rootCmd.PersistentFlags().DurationVar(&connectTimeout, "connect-timeout", 0, "timeout of connection to DB including all attempts (default is 10s)")
+	rootCmd.PersistentFlags().DurationVar(&retryInterval, "retry-interval", 0, "interval between attempts of connection to DB (default is 1s)")
+	rootCmd.PersistentFlags().IntVar(&maxAttempts, "max-attempts", 0, "max number of attempts of connection to DB (default is unlimited within the connect timeout)")
+	rootCmd.PersistentFlags().IntVar(&retryMaxAttempts, "retry-max-attempts", 0, "max number of attempts of a migration failed by transient errors (default is no retries)")
+	rootCmd.PersistentFlags().DurationVar(&retryBackoff, "retry-backoff", 0, "delay before the first retry of a migration, it is doubled for each next one (default is 100ms)")
+	rootCmd.PersistentFlags().StringSliceVar(&retryClasses, "retry-classes", nil, "SQLSTATE classes or codes of retryable errors (default is " + fmt.Sprintf("%v", api.DefaultRetryClasses) + ")")
+	rootCmd.PersistentFlags().BoolVar(&ignoreMissing, "ignore-missing", false, "continue if applied migrations are missing from code")
+	rootCmd.PersistentFlags().BoolVar(&disallowGaps, "disallow-gaps", false, "forbid gaps between IDs of migrations")
+	rootCmd.PersistentFlags().StringVar(&outOfOrder, "out-of-order", "", "policy for migrations older than the last applied one. Must be one of this: " + fmt.Sprintf("%v", api.OutOfOrderPolicies))
 
 	err := viper.BindPFlag("log", rootCmd.PersistentFlags().Lookup("log"))
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
+	err = viper.BindPFlag("logFormat", rootCmd.PersistentFlags().Lookup("log-format"))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	err = viper.BindPFlag("logLevel", rootCmd.PersistentFlags().Lookup("log-level"))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
 	err = viper.BindPFlag("dsn", rootCmd.PersistentFlags().Lookup("dsn"))
 	if err != nil {
 		fmt.Println(err)
@@ -58,14 +107,77 @@ func init() {
 		fmt.Println(err)
 		os.Exit(1)
 	}
+	err = viper.BindPFlag("namespace", rootCmd.PersistentFlags().Lookup("namespace"))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	err = viper.BindPFlag("dirs", rootCmd.PersistentFlags().Lookup("dirs"))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	err = viper.BindPFlag("cacheDir", rootCmd.PersistentFlags().Lookup("cache-dir"))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	err = viper.BindPFlag("metricsTextfile", rootCmd.PersistentFlags().Lookup("metrics-textfile"))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	err = viper.BindPFlag("connectTimeout", rootCmd.PersistentFlags().Lookup("connect-timeout"))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	err = viper.BindPFlag("retryInterval", rootCmd.PersistentFlags().Lookup("retry-interval"))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	err = viper.BindPFlag("maxAttempts", rootCmd.PersistentFlags().Lookup("max-attempts"))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	err = viper.BindPFlag("retry.maxAttempts", rootCmd.PersistentFlags().Lookup("retry-max-attempts"))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	err = viper.BindPFlag("retry.backoff", rootCmd.PersistentFlags().Lookup("retry-backoff"))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	err = viper.BindPFlag("retry.classes", rootCmd.PersistentFlags().Lookup("retry-classes"))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	err = viper.BindPFlag("ignoreMissing", rootCmd.PersistentFlags().Lookup("ignore-missing"))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	err = viper.BindPFlag("disallowGaps", rootCmd.PersistentFlags().Lookup("disallow-gaps"))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	err = viper.BindPFlag("outOfOrder", rootCmd.PersistentFlags().Lookup("out-of-order"))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
 
 }
 
 
-// initSQLMigrator reads in config file and ENV variables if set.
-func initSQLMigrator() {
-	var config api.Configuration
-
+// initConfig reads in config file and ENV variables if set.
+func initConfig() {
 	if cfgFile != "" {
 		// Use config file from the flag.
 		viper.SetConfigFile(cfgFile)
@@ -96,13 +208,32 @@ func initSQLMigrator() {
 		os.Exit(1)
 	}
 	config.ExpandEnv()
+}
+
+// initSQLMigrator initialises DBMigrator for the command
+func initSQLMigrator(cmd *cobra.Command) {
+	config.Offline = cmd.Annotations[annotationOffline] != ""
+	config.ReadOnly = cmd.Annotations[annotationReadOnly] != ""
 
-	//err = dbmigrator.Init(ctx, config, nil)
-	err = dbmigrator.InitTool(ctx, config, nil)
+	//err := dbmigrator.Init(ctx, config, nil)
+	err := dbmigrator.InitTool(ctx, config, nil)
 	if err != nil {
 		fmt.Println(err)
-		os.Exit(1)
+		os.Exit(exitCode(err))
 	}
 
 }
 
+// exitCode returns the exit code for the error: distinct codes for unreachable DB, lock timeout and a failed migration, otherwise 1
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, api.ErrDBUnreachable):
+		return api.ExitCodeDBUnreachable
+	case errors.Is(err, api.ErrLockTimeout):
+		return api.ExitCodeLockTimeout
+	case errors.Is(err, api.ErrUsersSQL), errors.Is(err, api.ErrUsersFunc):
+		return api.ExitCodeMigrationFailed
+	}
+	return 1
+}
+
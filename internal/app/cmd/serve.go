@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/Kalinin-Andrey/dbmigrator/pkg/dbmigrator"
+)
+
+var addr string
+
+// shutdownTimeout is the timeout of graceful shutdown of the server
+const shutdownTimeout = 5 * time.Second
+
+// serveCmd represents the serve command
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serves the status of migrations over HTTP.",
+	Long: `Serves the status of migrations over HTTP:
+  /status - the DB version and pending migrations as JSON;
+  /ready  - 200 if all migrations are applied, otherwise 503.
+The command does not execute migrations, readiness reflects only whether migrations are pending, they are applied by other runs;
+"running" and "last_error" are reported by the handlers of an application that executes migrations itself.
+The DB status is cached for ` + dbmigrator.StatusTTL.String() + ".",
+	Annotations: map[string]string{
+		annotationReadOnly: "true",
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		mux := http.NewServeMux()
+		mux.Handle("/status", dbmigrator.StatusHandler())
+		mux.Handle("/ready", dbmigrator.ReadinessHandler())
+
+		server := &http.Server{
+			Addr:		addr,
+			Handler:	mux,
+		}
+		c, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		go func() {
+			<-c.Done()
+			sc, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+			defer cancel()
+			_ = server.Shutdown(sc)
+		}()
+
+		fmt.Println("listening on", addr)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+
+	serveCmd.Flags().StringVar(&addr, "addr", ":8080", "Address of the HTTP server.")
+}
@@ -3,8 +3,11 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
 
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 
 	"github.com/Kalinin-Andrey/dbmigrator/pkg/dbmigrator"
@@ -15,18 +18,44 @@ import (
 var statusCmd = &cobra.Command{
 	Use:   "status",
 	Short: "Outputs saved in db logs of migrations.",
-	Long: `Outputs saved in db logs of migrations.`,
+	Long: `Outputs saved in db logs of migrations and migrations that are not applied yet.`,
+	Annotations: map[string]string{
+		annotationReadOnly: "true",
+	},
 	Run: func(cmd *cobra.Command, args []string) {
 		fmt.Println("status called")
 		ms, err := dbmigrator.Status()
+		if errors.Is(err, api.ErrNoTable) {
+			fmt.Println("no history table")
+			return
+		}
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		plan, err := dbmigrator.Plan()
 		if err != nil {
 			fmt.Println(err)
 			os.Exit(1)
 		}
+		ids := make(map[uint]bool, len(ms))
+
+		for _, m := range ms {
+			ids[m.ID] = true
+		}
+
+		for _, m := range plan {
+			if !ids[m.ID] {
+				ms = append(ms, m)
+			}
+		}
+		// repeatable migrations without IDs are applied after versioned ones
+		sort.SliceStable(ms, func(i, j int) bool { return ms[i].ID != 0 && (ms[j].ID == 0 || ms[i].ID < ms[j].ID) })
 		printHeader()
 
 		for _, m := range ms {
-			fmt.Printf("| %6d | %-50s | %11s | %v |\n", m.ID, m.Name, api.MigrationStatuses[int(m.Status)], m.Time)
+			fmt.Printf("| %6s | %-50s | %11s | %v |\n", migrationLabel(m.ID), m.Name, api.MigrationStatuses[int(m.Status)], m.Time)
 		}
 
 		printLine()
@@ -40,6 +69,14 @@ func printHeader() {
 	printLine()
 }
 
+// migrationLabel returns the ID of a migration for output, repeatable migrations are marked by R
+func migrationLabel(id uint) string {
+	if id == 0 {
+		return "R"
+	}
+	return strconv.FormatUint(uint64(id), 10)
+}
+
 func printLine() {
 	fmt.Println(strings.Repeat("-", 116))
 }
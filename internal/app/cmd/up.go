@@ -4,9 +4,11 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 
 	"github.com/Kalinin-Andrey/dbmigrator/pkg/dbmigrator"
+	"github.com/Kalinin-Andrey/dbmigrator/pkg/dbmigrator/api"
 
 )
 
@@ -20,7 +22,11 @@ var upCmd = &cobra.Command{
 		err := dbmigrator.Up(0)
 		if err != nil {
 			fmt.Println(err)
-			os.Exit(1)
+			// there is nothing to apply
+			if errors.Is(err, api.ErrNotFound) {
+				return
+			}
+			os.Exit(exitCode(err))
 		}
 	},
 }
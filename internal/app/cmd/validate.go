@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/Kalinin-Andrey/dbmigrator/pkg/dbmigrator"
+)
+
+// validateCmd represents the validate command
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Validates migrations without connection to DB.",
+	Long: `Validates migrations without connection to DB and reports all problems at once.`,
+	Annotations: map[string]string{
+		annotationOffline: "true",
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		err := dbmigrator.Validate()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Println("migrations are valid")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(validateCmd)
+}
@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/Kalinin-Andrey/dbmigrator/pkg/dbmigrator"
+	"github.com/Kalinin-Andrey/dbmigrator/pkg/dbmigrator/api"
+)
+
+// waitCmd represents the wait command
+var waitCmd = &cobra.Command{
+	Use:   "wait",
+	Short: "Waits for DB and applies migrations, e.g. in an init container.",
+	Long: `Waits until DB is reachable within the connect timeout and max attempts, then applies all migrations.
+Exit codes:
+  0 - migrations are applied or there is nothing to apply;
+  1 - other errors, e.g. invalid migrations or configuration;
+  4 - SQL or a func of a migration is failed;
+  5 - DB is unreachable, the last connection error is printed;
+  6 - a migration is failed by timeout of waiting for a lock.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		err := dbmigrator.Up(0)
+		if err != nil && !errors.Is(err, api.ErrNotFound) {
+			fmt.Println(err)
+			os.Exit(exitCode(err))
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(waitCmd)
+
+}
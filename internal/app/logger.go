@@ -1,10 +1,138 @@
 package app
 
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+)
+
 // Logger interface for application
 type Logger interface {
 	Print(v ...interface{})
 	Fatal(v ...interface{})
 }
 
+// SlogLogger is a Logger that writes to a slog logger, Print writes at the info level
+type SlogLogger struct {
+	*slog.Logger
+}
+
+var _ Logger = (*SlogLogger)(nil)
+
+// NewSlogLogger creates a new SlogLogger
+func NewSlogLogger(logger *slog.Logger) *SlogLogger {
+	return &SlogLogger{logger}
+}
+
+// Print writes the message at the info level
+func (l SlogLogger) Print(v ...interface{}) {
+	l.Info(fmt.Sprint(v...))
+}
 
+// Fatal writes the message at the error level and exits
+func (l SlogLogger) Fatal(v ...interface{}) {
+	l.Error(fmt.Sprint(v...))
+	os.Exit(1)
+}
+
+// Slog returns a slog logger for the logger: the wrapped one for SlogLogger, otherwise a logger that writes to Print of the logger at the info level
+func Slog(logger Logger) *slog.Logger {
+	if l, ok := logger.(*SlogLogger); ok {
+		return l.Logger
+	}
+	return slog.New(NewPrintHandler(logger, slog.LevelInfo))
+}
+
+// PrintHandler is a slog.Handler that writes records as lines "LEVEL message key=value ..." to Print of a Logger, the level is omitted for info
+type PrintHandler struct {
+	logger	Logger
+	level	slog.Leveler
+	attrs	string
+	prefix	string
+}
+
+var _ slog.Handler = (*PrintHandler)(nil)
+
+// NewPrintHandler creates a new PrintHandler, records below the level are dropped
+func NewPrintHandler(logger Logger, level slog.Leveler) *PrintHandler {
+	if level == nil {
+		level = slog.LevelInfo
+	}
+	return &PrintHandler{
+		logger:	logger,
+		level:	level,
+	}
+}
 
+// Enabled reports whether the handler handles records at the level
+func (h *PrintHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+// Handle writes the record
+func (h *PrintHandler) Handle(ctx context.Context, r slog.Record) error {
+	var b strings.Builder
+
+	if r.Level != slog.LevelInfo {
+		b.WriteString(r.Level.String())
+		b.WriteString(" ")
+	}
+	b.WriteString(r.Message)
+	b.WriteString(h.attrs)
+
+	r.Attrs(func(a slog.Attr) bool {
+		writeAttr(&b, h.prefix, a)
+		return true
+	})
+	h.logger.Print(b.String())
+	return nil
+}
+
+// WithAttrs returns a handler that writes the attrs with each record
+func (h *PrintHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	var b strings.Builder
+
+	for _, a := range attrs {
+		writeAttr(&b, h.prefix, a)
+	}
+	c := *h
+	c.attrs += b.String()
+	return &c
+}
+
+// WithGroup returns a handler that qualifies keys of attrs by the name of the group
+func (h *PrintHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	c := *h
+	c.prefix += name + "."
+	return &c
+}
+
+// writeAttr writes the attr as " key=value", values with spaces or quotes are quoted
+func writeAttr(b *strings.Builder, prefix string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+
+	if a.Value.Kind() == slog.KindGroup {
+		// attrs of a group without a key are inlined
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			writeAttr(b, prefix, ga)
+		}
+		return
+	}
+
+	value := a.Value.String()
+	if value == "" || strings.ContainsAny(value, " =\"") {
+		value = fmt.Sprintf("%q", value)
+	}
+	fmt.Fprintf(b, " %s%s=%s", prefix, a.Key, value)
+}
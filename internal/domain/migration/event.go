@@ -0,0 +1,90 @@
+package migration
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/Kalinin-Andrey/dbmigrator/internal/app"
+)
+
+const (
+	// EventStarted - execution of a migration is started
+	EventStarted	= "started"
+	// EventSucceeded - execution of a migration is finished successfully
+	EventSucceeded	= "succeeded"
+	// EventFailed - execution of a migration is failed
+	EventFailed		= "failed"
+	// EventSkipped - a migration is not executed: a repeatable migration is not changed or a previous migration of the run is failed
+	EventSkipped	= "skipped"
+)
+
+const (
+	// DirectionUp - up action of a migration
+	DirectionUp		= "up"
+	// DirectionDown - down action of a migration
+	DirectionDown	= "down"
+	// DirectionRedo - redo of the last migration, it is passed to beforeAll, afterAll and onError hooks of the run
+	DirectionRedo	= "redo"
+)
+
+// Event of execution of a migration
+type Event struct {
+	Type		string
+	ID			uint
+	Name		string
+	Direction	string
+	// Statements is the number of SQL statements of the action, it is 0 for a Func
+	Statements	int
+	Duration	time.Duration
+	Err			error
+}
+
+// Listener of events of execution of migrations
+type Listener interface {
+	OnEvent(e Event)
+}
+
+// Listeners is a list of listeners, that is a listener itself
+type Listeners []Listener
+
+var _ Listener = (Listeners)(nil)
+
+// OnEvent notifies all listeners
+func (l Listeners) OnEvent(e Event) {
+	for _, i := range l {
+		i.OnEvent(e)
+	}
+}
+
+// LogListener writes events to the logger with fields migration_id, name, direction and duration
+type LogListener struct {
+	logger	*slog.Logger
+}
+
+var _ Listener = (*LogListener)(nil)
+
+// NewLogListener creates a new LogListener
+func NewLogListener(logger app.Logger) *LogListener {
+	return &LogListener{app.Slog(logger)}
+}
+
+// OnEvent writes the event, started and skipped events are written at the debug level
+func (l LogListener) OnEvent(e Event) {
+	attrs := make([]interface{}, 0, 10)
+	// repeatable migrations have no ID
+	if e.ID != 0 {
+		attrs = append(attrs, "migration_id", e.ID)
+	}
+	attrs = append(attrs, "name", e.Name, "direction", e.Direction)
+
+	switch e.Type {
+	case EventStarted:
+		l.logger.Debug("migration started", attrs...)
+	case EventSucceeded:
+		l.logger.Info("migration done", append(attrs, "duration", e.Duration)...)
+	case EventFailed:
+		l.logger.Error("migration failed", append(attrs, "duration", e.Duration, "error", e.Err)...)
+	case EventSkipped:
+		l.logger.Debug("migration skipped", attrs...)
+	}
+}
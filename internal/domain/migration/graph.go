@@ -0,0 +1,130 @@
+package migration
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pkg/errors"
+
+	"github.com/Kalinin-Andrey/dbmigrator/internal/pkg/apperror"
+)
+
+// Dependency is a migration that must be applied before a dependent one
+type Dependency struct {
+	// Namespace of the migration, the empty namespace is the namespace of the dependent migration
+	Namespace	string
+	ID			uint
+}
+
+// Validate method
+func (d Dependency) Validate() error {
+	return validation.ValidateStruct(&d,
+		validation.Field(&d.Namespace, namespaceRule...),
+		validation.Field(&d.ID, validation.Required),
+	)
+}
+
+// String returns the dependency as namespace#id or #id for the namespace of the dependent migration
+func (d Dependency) String() string {
+	return fmt.Sprintf("%s#%d", d.Namespace, d.ID)
+}
+
+// IsLocal returns true if the dependency belongs to the namespace of the migration m
+func (d Dependency) IsLocal(m Migration) bool {
+	return d.Namespace == "" || d.Namespace == m.Namespace
+}
+
+// Order returns ids of migrations of the list in topological order of their dependencies, independent migrations are ordered by ID.
+// Dependencies on migrations that are not in ids are considered satisfied.
+func (l MigrationsList) Order(ids []int) ([]int, error) {
+	in := make(map[uint]bool, len(ids))
+
+	for _, id := range ids {
+		in[uint(id)] = true
+	}
+	// the number of not ordered dependencies and the list of dependents of each migration
+	pending		:= make(map[uint]int, len(ids))
+	dependents	:= make(map[uint][]uint, len(ids))
+
+	for _, id := range ids {
+		m := l[uint(id)]
+
+		for _, d := range m.DependsOn {
+			if d.IsLocal(m) && in[d.ID] {
+				pending[m.ID]++
+				dependents[d.ID] = append(dependents[d.ID], m.ID)
+			}
+		}
+	}
+	ready := make([]int, 0, len(ids))
+
+	for _, id := range ids {
+		if pending[uint(id)] == 0 {
+			ready = append(ready, id)
+		}
+	}
+	order := make([]int, 0, len(ids))
+
+	for len(ready) > 0 {
+		sort.Ints(ready)
+		id := ready[0]
+		ready = ready[1:]
+		order = append(order, id)
+
+		for _, d := range dependents[uint(id)] {
+			pending[d]--
+			if pending[d] == 0 {
+				ready = append(ready, int(d))
+			}
+		}
+	}
+
+	if len(order) < len(ids) {
+		cycle := make([]string, 0, len(ids) - len(order))
+
+		for _, id := range ids {
+			if pending[uint(id)] > 0 {
+				cycle = append(cycle, fmt.Sprintf("#%d", id))
+			}
+		}
+		sort.Strings(cycle)
+		return nil, errors.Wrapf(apperror.ErrInvalid, "Cycle in dependencies of migrations: %v", strings.Join(cycle, ", "))
+	}
+	return order, nil
+}
+
+// WriteGraph writes the dependency graph of migrations of the list in DOT format, edges are directed from a dependency to a dependent migration
+func (l MigrationsList) WriteGraph(wr io.Writer) error {
+	ids := l.IDs()
+	sort.Ints(ids)
+	lines := []string{"digraph migrations {"}
+
+	for _, id := range ids {
+		m := l[uint(id)]
+		lines = append(lines, fmt.Sprintf("\t%q [label=%q];", graphNode(m.Namespace, m.ID), fmt.Sprintf("#%d %s", m.ID, m.Name)))
+	}
+
+	for _, id := range ids {
+		m := l[uint(id)]
+
+		for _, d := range m.DependsOn {
+			namespace := d.Namespace
+			if d.IsLocal(m) {
+				namespace = m.Namespace
+			}
+			lines = append(lines, fmt.Sprintf("\t%q -> %q;", graphNode(namespace, d.ID), graphNode(m.Namespace, m.ID)))
+		}
+	}
+	lines = append(lines, "}", "")
+
+	_, err := io.WriteString(wr, strings.Join(lines, "\n"))
+	return err
+}
+
+// graphNode returns an ID of a node of the graph for a migration
+func graphNode(namespace string, id uint) string {
+	return Dependency{Namespace: namespace, ID: id}.String()
+}
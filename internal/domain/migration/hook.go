@@ -0,0 +1,225 @@
+package migration
+
+import (
+	"context"
+
+	"github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+
+	"github.com/Kalinin-Andrey/dbmigrator/internal/pkg/apperror"
+)
+
+const (
+	// HookBeforeAll - before execution of a batch of migrations, on the connection of the run that executes the migrations, e.g. for SET lock_timeout
+	HookBeforeAll	= "beforeAll"
+	// HookBeforeEach - before a migration, in the transaction of the migration
+	HookBeforeEach	= "beforeEach"
+	// HookAfterEach - after a migration, in the transaction of the migration
+	HookAfterEach	= "afterEach"
+	// HookAfterAll - after successful execution of a batch of migrations and commit of their history log; on a failure migrations stay applied and onError hooks are run
+	HookAfterAll	= "afterAll"
+	// HookOnError - after a failure of execution of migrations
+	HookOnError		= "onError"
+)
+
+// HookPoints is slice of the hook points
+var HookPoints = []interface{}{HookBeforeAll, HookBeforeEach, HookAfterEach, HookAfterAll, HookOnError}
+
+// HookInfo is metadata of execution passed to a hook; ID, Name and Namespace are empty for beforeAll and afterAll hooks
+type HookInfo struct {
+	Point		string
+	Direction	string
+	ID			uint
+	Name		string
+	Namespace	string
+	// Err is the error of execution for onError hooks
+	Err			error
+}
+
+// HookFunc is func for hooks
+type HookFunc func(tx *sqlx.Tx, info HookInfo) error
+
+// Hook is an action that is run at the hook point
+type Hook struct {
+	Point		string
+	// Action is a HookFunc or a string (plain SQL text)
+	Action		interface{}
+	// Source is a file of the hook, it is used in messages of errors
+	Source		string
+}
+
+// Hooks is a slice of Hook
+type Hooks []Hook
+
+// Validate method
+func (h Hook) Validate() error {
+	return validation.ValidateStruct(&h,
+		validation.Field(&h.Point, validation.Required, validation.In(HookPoints...)),
+		validation.Field(&h.Action, validation.NotNil, validation.Required, validation.By(hookFuncOrStringRule)),
+	)
+}
+
+func hookFuncOrStringRule(value interface{}) (err error) {
+	switch v := value.(type) {
+	case string:
+		err = checkSQL(v)
+	case HookFunc:
+	default:
+		err = apperror.ErrUndefinedTypeOfAction
+	}
+	return err
+}
+
+// Point returns hooks of the point in order of addition
+func (l Hooks) Point(point string) Hooks {
+	var hooks Hooks
+
+	for _, h := range l {
+		if h.Point == point {
+			hooks = append(hooks, h)
+		}
+	}
+	return hooks
+}
+
+// action returns an action of the hook for execution by a repository
+func (h Hook) action(info HookInfo) interface{} {
+	f, ok := h.Action.(HookFunc)
+	if !ok {
+		return h.Action
+	}
+	return Func(func(tx *sqlx.Tx) error {
+		return f(tx, info)
+	})
+}
+
+// hookInfo returns metadata of the migration for hooks
+func (m Migration) hookInfo(direction string) HookInfo {
+	return HookInfo{
+		Direction:	direction,
+		ID:			m.ID,
+		Name:		m.Name,
+		Namespace:	m.Namespace,
+	}
+}
+
+// runHooks runs hooks of the point in the transaction t, hooks are run in a new transaction if t is nil
+func (s Service) runHooks(ctx context.Context, t Transaction, point string, info HookInfo) (err error) {
+	hooks := s.options.Hooks.Point(point)
+	if len(hooks) == 0 {
+		return nil
+	}
+	info.Point = point
+	own := t == nil
+
+	if own {
+		if t, err = s.repo.BeginTx(ctx); err != nil {
+			return errors.Wrapf(err, "migration.Service: %v hooks transaction begin error", point)
+		}
+	}
+
+	for _, h := range hooks {
+		if err = s.actionExecTx(ctx, t, h.action(info)); err != nil {
+			err = errors.Wrapf(err, "%v hook error %v", point, h.Source)
+			if own {
+				if er := t.Rollback(); er != nil {
+					return errors.Wrapf(er, "migration.Service: %v hooks transaction rollback error", point)
+				}
+			}
+			return err
+		}
+	}
+
+	if own {
+		if err = t.Commit(); err != nil {
+			return errors.Wrapf(err, "migration.Service: %v hooks transaction commit error", point)
+		}
+	}
+	return nil
+}
+
+// session runs beforeAll hooks and returns a copy of the service that executes migrations of a run on the same dedicated connection,
+// so that settings of the session made by beforeAll hooks (e.g. SET lock_timeout) are applied to migrations.
+// The hooks are run again on a new connection that replaces a dropped one. Without beforeAll hooks migrations are executed on the pool.
+func (s Service) session(ctx context.Context, info HookInfo) (Service, error) {
+	if len(s.options.Hooks.Point(HookBeforeAll)) == 0 {
+		return s, nil
+	}
+
+	repo, err := s.repo.Session(ctx, func(ctx context.Context, t Transaction) error {
+		return s.runHooks(ctx, t, HookBeforeAll, info)
+	})
+	if err != nil {
+		return s, err
+	}
+	s.repo = repo
+	return s, nil
+}
+
+// close releases the connection of the session, an error is logged because the run is already finished
+func (s Service) close() {
+	if err := s.repo.Close(); err != nil {
+		s.logger.Error("session close error", "error", err)
+	}
+}
+
+// afterAll runs afterAll hooks after the history log of the run is committed.
+// Migrations stay applied on a failure of a hook, the failure is reported as the error of the run after onError hooks on every path.
+func (s Service) afterAll(ctx context.Context, direction string) error {
+	info := HookInfo{Direction: direction}
+
+	if err := s.runHooks(ctx, nil, HookAfterAll, info); err != nil {
+		s.onError(ctx, info, err)
+		return err
+	}
+	return nil
+}
+
+// onError runs onError hooks, their errors are logged to not hide the error of execution
+func (s Service) onError(ctx context.Context, info HookInfo, err error) {
+	info.Err = err
+
+	if er := s.runHooks(ctx, nil, HookOnError, info); er != nil {
+		s.logger.Error("onError hooks failed", "error", er)
+	}
+}
+
+// exec executes an action of the migration with beforeEach and afterEach hooks in one transaction
+func (s Service) exec(ctx context.Context, direction string, m Migration, action interface{}) error {
+	if len(s.options.Hooks.Point(HookBeforeEach)) == 0 && len(s.options.Hooks.Point(HookAfterEach)) == 0 {
+		// the migration is executed in its own transaction, that may be retried by the repository
+		return s.actionExec(WithIdempotent(ctx, m.Idempotent), action)
+	}
+
+	t, err := s.repo.BeginTx(ctx)
+	if err != nil {
+		return errors.Wrapf(err, "migration.Service.exec: transaction begin error")
+	}
+
+	if err = s.execTx(ctx, t, direction, m, action); err != nil {
+		if er := t.Rollback(); er != nil {
+			return errors.Wrapf(er, "migration.Service.exec: transaction rollback error")
+		}
+		return err
+	}
+
+	if err = t.Commit(); err != nil {
+		return errors.Wrapf(err, "migration.Service.exec: transaction commit error")
+	}
+	return nil
+}
+
+// execTx executes an action of the migration with beforeEach and afterEach hooks in the transaction t
+func (s Service) execTx(ctx context.Context, t Transaction, direction string, m Migration, action interface{}) error {
+	info := m.hookInfo(direction)
+
+	if err := s.runHooks(ctx, t, HookBeforeEach, info); err != nil {
+		return err
+	}
+
+	if err := s.actionExecTx(ctx, t, action); err != nil {
+		return err
+	}
+	return s.runHooks(ctx, t, HookAfterEach, info)
+}
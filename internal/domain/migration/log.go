@@ -7,6 +7,7 @@ import (
 
 // Log struct
 type Log struct {
+	Namespace		string
 	ID				uint
 	Status			uint
 	Name			string
@@ -32,13 +33,34 @@ const (
 
 // SQLCreateTable is the SQL text for creation table
 var SQLCreateTable string = `CREATE TABLE IF NOT EXISTS public."` + TableName + `" (
-	id int4 NOT NULL,
+	namespace varchar(100) NOT NULL DEFAULT '',
+	id int8 NOT NULL,
 	status int4 NOT NULL DEFAULT 0,
 	name varchar(100) NOT NULL,
 	"time" timestamptz NOT NULL DEFAULT Now(),
-	CONSTRAINT migration_pkey PRIMARY KEY (id)
+	CONSTRAINT migration_pkey PRIMARY KEY (namespace, id)
 );`
 
+// SQLUpgradeTable is the list of SQL texts for upgrading a table created by previous versions
+var SQLUpgradeTable = []string{
+	// timestamp IDs do not fit into int4
+	`DO $$
+BEGIN
+	IF EXISTS (SELECT 1 FROM information_schema.columns WHERE table_schema = 'public' AND table_name = '` + TableName + `' AND column_name = 'id' AND data_type = 'integer') THEN
+		ALTER TABLE public."` + TableName + `" ALTER COLUMN id TYPE int8;
+	END IF;
+END $$;`,
+	// each namespace has an independent sequence of IDs
+	`DO $$
+BEGIN
+	IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_schema = 'public' AND table_name = '` + TableName + `' AND column_name = 'namespace') THEN
+		ALTER TABLE public."` + TableName + `" ADD COLUMN namespace varchar(100) NOT NULL DEFAULT '';
+		ALTER TABLE public."` + TableName + `" DROP CONSTRAINT migration_pkey;
+		ALTER TABLE public."` + TableName + `" ADD CONSTRAINT migration_pkey PRIMARY KEY (namespace, id);
+	END IF;
+END $$;`,
+}
+
 // QueryCondition struct for defining a query condition
 type QueryCondition struct {
 	Where	*WhereCondition
@@ -149,6 +171,30 @@ func MigrationsLogsFilterExistsByKeys(sourceList LogsList, existList LogsList) (
 	return l
 }
 
+// MigrationsLogsFilterExceptByMigrations returns LogsList with all entities from sourceList other than those represented in exceptList of migrations
+func MigrationsLogsFilterExceptByMigrations(sourceList LogsList, exceptList MigrationsList) (l LogsList) {
+	l = make(LogsList)
+
+	for id, m := range sourceList {
+		if _, ok := exceptList[id]; !ok {
+			l[id] = m
+		}
+	}
+
+	return l
+}
+
+// List converts LogsSlice to LogsList
+func (s LogsSlice) List() (l LogsList) {
+	l = make(LogsList, len(s))
+
+	for _, ml := range s {
+		l[ml.ID] = ml
+	}
+
+	return l
+}
+
 // Len returns length
 func (s LogsSlice) Len() int {
 	return len(s)
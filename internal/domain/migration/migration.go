@@ -2,10 +2,13 @@ package migration
 
 import (
 	"regexp"
+	"sort"
+	"strconv"
+	"time"
 
 	"github.com/go-ozzo/ozzo-validation/v4"
-	"github.com/go-ozzo/ozzo-validation/v4/is"
 	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
 
 	"github.com/Kalinin-Andrey/dbmigrator/internal/pkg/apperror"
 )
@@ -18,6 +21,54 @@ const MigrationTypeGo = "go"
 // MigrationTypes is slice of migration types
 var MigrationTypes = []interface{}{MigrationTypeSQL, MigrationTypeGo}
 
+// IDSchemeSequence - IDs of new migrations are allocated as max existing ID + 1
+const IDSchemeSequence = "sequence"
+// IDSchemeTimestamp - IDs of new migrations are allocated as a timestamp YYYYMMDDHHMMSS
+const IDSchemeTimestamp = "timestamp"
+
+// IDSchemes is slice of ID schemes
+var IDSchemes = []interface{}{IDSchemeSequence, IDSchemeTimestamp}
+
+const (
+	// idWidthSequence is the width of the zero-padded ID in a file name for the sequence scheme
+	idWidthSequence		= 3
+	// idWidthTimestamp is the width of the zero-padded ID in a file name for the timestamp scheme
+	idWidthTimestamp	= 14
+	// timestampIDLayout is the layout of a timestamp ID
+	timestampIDLayout	= "20060102150405"
+)
+
+// IDWidth returns the width of the zero-padded ID in a file name, so that file names are sorted as IDs
+func IDWidth(scheme string) int {
+	if scheme == IDSchemeTimestamp {
+		return idWidthTimestamp
+	}
+	return idWidthSequence
+}
+
+// TimestampID returns an ID for the timestamp scheme, it is out of range of uint on 32-bit platforms
+func TimestampID(t time.Time) (uint, error) {
+	id, err := strconv.ParseUint(t.UTC().Format(timestampIDLayout), 10, strconv.IntSize)
+	if err != nil {
+		return 0, errors.Wrapf(apperror.ErrBadRequest, "Can not make a timestamp ID: %v", err)
+	}
+	return uint(id), nil
+}
+
+// nameRegexp is the regular expression for a name of migration
+var nameRegexp = regexp.MustCompile("^[a-zA-Z0-9_-]+$")
+
+// namespaceRule is the rule for a namespace of migrations, the empty namespace is the default one
+var namespaceRule = []validation.Rule{
+	validation.Length(0, 100),
+	validation.Match(nameRegexp),
+}
+
+// ValidateNamespace validates a namespace of migrations
+func ValidateNamespace(namespace string) error {
+	return validation.Validate(namespace, namespaceRule...)
+}
+
 // CreateParams is struct for params for creation of migration
 type CreateParams struct {
 	ID		uint
@@ -30,7 +81,15 @@ func (p CreateParams) Validate() error {
 	return validation.ValidateStruct(&p,
 		validation.Field(&p.ID, validation.Required),
 		validation.Field(&p.Type, validation.Required, validation.In(MigrationTypes...)),
-		validation.Field(&p.Name, validation.Required, validation.Length(1, 100), validation.Match(regexp.MustCompile("^[a-zA-Z0-9_-]+$"))),
+		validation.Field(&p.Name, validation.Required, validation.Length(1, 100), validation.Match(nameRegexp)),
+	)
+}
+
+// ValidateDraft validates params before allocation of ID
+func (p CreateParams) ValidateDraft() error {
+	return validation.ValidateStruct(&p,
+		validation.Field(&p.Type, validation.Required, validation.In(MigrationTypes...)),
+		validation.Field(&p.Name, validation.Required, validation.Length(1, 100), validation.Match(nameRegexp)),
 	)
 }
 
@@ -41,6 +100,14 @@ type Migration struct {
 	Name	string
 	Up		interface{}
 	Down	interface{}
+	// Namespace is a set of migrations with an independent sequence of IDs, a migration without a namespace belongs to the namespace of the run
+	Namespace	string
+	// DependsOn are migrations that must be applied before this one
+	DependsOn	[]Dependency
+	// Idempotent migrations may be retried even if it is unknown whether their transaction is committed
+	Idempotent	bool
+	// Source is a file of the migration, it is used in messages of errors
+	Source	string
 }
 
 // Func is func for migrations Up/Down
@@ -57,16 +124,35 @@ func (m Migration) Validate() error {
 
 	err := validation.ValidateStruct(&m,
 		validation.Field(&m.ID, validation.Required),
-		validation.Field(&m.Name, validation.Required, validation.RuneLength(2, 100), is.UTFLetter),
+		validation.Field(&m.Name, validation.Required, validation.Length(1, 100), validation.Match(nameRegexp)),
+		validation.Field(&m.Namespace, namespaceRule...),
+		validation.Field(&m.DependsOn),
 		validation.Field(&m.Up, migrationRule...),
 		validation.Field(&m.Down, migrationRule...),
 	)
 	return err
 }
 
+// statements returns the number of SQL statements of the action of the migration in the direction, it is 0 for a Func
+func (m Migration) statements(direction string) int {
+	action := m.Up
+	if direction == DirectionDown {
+		action = m.Down
+	}
+
+	if sql, ok := action.(string); ok {
+		return CountStatements(sql)
+	}
+	return 0
+}
+
+// migrationFuncOrStringRule checks an action of a migration; a blank SQL text is allowed here, so that a created migration does not break registration of migrations, it is reported by Service.Validate
 func migrationFuncOrStringRule(value interface{}) (err error) {
-	switch value.(type) {
+	switch v := value.(type) {
 	case string:
+		if err = checkSQL(v); errors.Is(err, errBlankSQL) {
+			err = nil
+		}
 	case Func:
 	default:
 		err = apperror.ErrUndefinedTypeOfAction
@@ -96,4 +182,19 @@ func (l MigrationsList) IDs() (ids []int) {
 	return ids
 }
 
+// Gaps returns pairs of neighboring IDs with missing IDs between them
+func (l MigrationsList) Gaps() (gaps [][2]uint) {
+	ids := l.IDs()
+	sort.Ints(ids)
+	prev := 0
+
+	for _, id := range ids {
+		if id > prev+1 {
+			gaps = append(gaps, [2]uint{uint(prev), uint(id)})
+		}
+		prev = id
+	}
+	return gaps
+}
+
 
@@ -0,0 +1,54 @@
+package migration
+
+import (
+	"github.com/go-ozzo/ozzo-validation/v4"
+)
+
+const (
+	// OutOfOrderAllow - out-of-order migrations are applied silently
+	OutOfOrderAllow		= "allow"
+	// OutOfOrderWarn - out-of-order migrations are applied with a warning
+	OutOfOrderWarn		= "warn"
+	// OutOfOrderReject - out-of-order migrations are not applied
+	OutOfOrderReject	= "reject"
+)
+
+// OutOfOrderPolicies is slice of out-of-order policies
+var OutOfOrderPolicies = []interface{}{OutOfOrderAllow, OutOfOrderWarn, OutOfOrderReject}
+
+// Options of the Service
+type Options struct {
+	// OutOfOrder is a policy for migrations older than the last applied one
+	OutOfOrder	string
+	// IDScheme is a scheme of allocation of IDs for new migrations
+	IDScheme	string
+	// Templates are files of templates for new migrations
+	Templates	Templates
+	// DisallowGaps forbids gaps between IDs of migrations, it is not compatible with IDSchemeTimestamp
+	DisallowGaps	bool
+	// Listeners of events of execution of migrations
+	Listeners	Listeners
+	// Hooks are run around execution of migrations
+	Hooks		Hooks
+	// Retry is a policy of retries of transactions of migrations failed by transient errors
+	Retry		RetryPolicy
+}
+
+// Templates are paths to files of templates for new migrations, the builtin template is used for an empty path
+type Templates struct {
+	Go			string
+	SQLUp		string
+	SQLDown		string
+}
+
+// Validate method
+func (o Options) Validate() error {
+	return validation.ValidateStruct(&o,
+		validation.Field(&o.OutOfOrder, validation.In(OutOfOrderPolicies...)),
+		validation.Field(&o.IDScheme, validation.In(IDSchemes...)),
+		// timestamp IDs always have gaps
+		validation.Field(&o.DisallowGaps, validation.When(o.IDScheme == IDSchemeTimestamp, validation.Empty.Error("must not be set with the timestamp ID scheme"))),
+		validation.Field(&o.Hooks),
+		validation.Field(&o.Retry),
+	)
+}
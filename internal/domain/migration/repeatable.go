@@ -0,0 +1,99 @@
+package migration
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+// TableNameRepeatable is the name of the table with logs of repeatable migrations
+const TableNameRepeatable = "dbmigrator_repeatable"
+
+// SQLCreateRepeatableTable is the SQL text for creation table of logs of repeatable migrations
+var SQLCreateRepeatableTable string = `CREATE TABLE IF NOT EXISTS public."` + TableNameRepeatable + `" (
+	namespace varchar(100) NOT NULL DEFAULT '',
+	name varchar(100) NOT NULL,
+	checksum varchar(64) NOT NULL,
+	"time" timestamptz NOT NULL DEFAULT Now(),
+	CONSTRAINT repeatable_pkey PRIMARY KEY (namespace, name)
+);`
+
+// Repeatable is a migration that is applied again whenever its checksum changes, e.g. a view, a function or a trigger.
+// Repeatable migrations are applied after all versioned migrations in order of names.
+type Repeatable struct {
+	Name		string
+	// Up is a Func or a string (plain SQL text)
+	Up			interface{}
+	// Checksum identifies a version of Up, it is computed for SQL and is required for Func
+	Checksum	string
+	// Namespace of the migration, a migration without a namespace belongs to the namespace of the run
+	Namespace	string
+	// Source is a file of the migration, it is used in messages of errors
+	Source		string
+}
+
+// RepeatablesList is a map of Repeatable by names
+type RepeatablesList map[string]Repeatable
+
+// RepeatableLog is a log of an applied repeatable migration
+type RepeatableLog struct {
+	Namespace	string
+	Name		string
+	Checksum	string
+	Time		time.Time
+}
+
+// Validate method
+func (r Repeatable) Validate() error {
+	_, isFunc := r.Up.(Func)
+
+	return validation.ValidateStruct(&r,
+		validation.Field(&r.Name, validation.Required, validation.Length(1, 100), validation.Match(nameRegexp)),
+		validation.Field(&r.Namespace, namespaceRule...),
+		validation.Field(&r.Up, migrationRule...),
+		validation.Field(&r.Checksum, validation.When(isFunc, validation.Required), validation.Length(0, 64)),
+	)
+}
+
+// Sum returns the checksum of the migration, the checksum of SQL is computed if it is not set
+func (r Repeatable) Sum() string {
+	if r.Checksum != "" {
+		return r.Checksum
+	}
+	sql, _ := r.Up.(string)
+	h := sha256.Sum256([]byte(sql))
+	return hex.EncodeToString(h[:])
+}
+
+// Migration returns the repeatable migration as a migration without ID for events
+func (r Repeatable) Migration() Migration {
+	return Migration{
+		Name:		r.Name,
+		Up:			r.Up,
+		Namespace:	r.Namespace,
+		Source:		r.Source,
+	}
+}
+
+// Log returns a log of the applied migration
+func (r Repeatable) Log() *RepeatableLog {
+	return &RepeatableLog{
+		Namespace:	r.Namespace,
+		Name:		r.Name,
+		Checksum:	r.Sum(),
+	}
+}
+
+// Names returns sorted names
+func (l RepeatablesList) Names() []string {
+	names := make([]string, 0, len(l))
+
+	for name := range l {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -6,10 +6,17 @@ import (
 	"github.com/Kalinin-Andrey/dbmigrator/internal/app"
 )
 
+// SessionSetup is run in a transaction on each new connection of a session, e.g. to run beforeAll hooks
+type SessionSetup func(ctx context.Context, t Transaction) error
+
 // IRepository encapsulates the logic to access albums from the data source.
 type IRepository interface {
 	// SetLogger is setter for logger
 	SetLogger(logger app.Logger)
+	// SetRetryPolicy is setter for the policy of retries of transactions of migrations failed by transient errors
+	SetRetryPolicy(policy RetryPolicy)
+	// SetNamespace is setter for the namespace of migrations, all operations are limited by it
+	SetNamespace(namespace string)
 	// Get returns an entity with the specified ID.
 	//Get(ctx context.Context, id uint) (*Log, error)
 	// Count returns the number of entities.
@@ -38,10 +45,23 @@ type IRepository interface {
 	ExecFuncTx(ctx context.Context, t Transaction, f Func) (err error)
 	// BeginTx begins a transaction
 	BeginTx(ctx context.Context) (Transaction, error)
+	// Session returns a repository that begins all transactions on one dedicated connection, so that settings of the session made by the setup are kept for migrations;
+	// the setup is run on the connection and again on a new one that replaces a dropped connection; it must be closed
+	Session(ctx context.Context, setup SessionSetup) (IRepository, error)
+	// Close resets settings of a session and releases its dedicated connection, it is no-op for a repository that is not a session
+	Close() error
+	// IsAppliedTx returns true if the migration with the ID of the namespace is applied, the namespace may differ from the namespace of the repository
+	IsAppliedTx(ctx context.Context, t Transaction, namespace string, id uint) (bool, error)
+	// QueryRepeatable returns the list of logs of repeatable migrations
+	QueryRepeatable(ctx context.Context) ([]RepeatableLog, error)
+	// SaveRepeatableTx creates or updates a log of a repeatable migration with transaction
+	SaveRepeatableTx(ctx context.Context, t Transaction, l *RepeatableLog) error
 	// BatchCreateTx creates a batch of MigrationsLog with transaction
 	BatchCreateTx(ctx context.Context, t Transaction, list LogsList) error
 	// BatchUpdateTx updates a batch of MigrationsLog with transaction
 	BatchUpdateTx(ctx context.Context, t Transaction, list LogsList) error
+	// BatchDeleteTx deletes a batch of MigrationsLog with transaction
+	BatchDeleteTx(ctx context.Context, t Transaction, list LogsList) error
 }
 
 // Transaction for operations in domain level
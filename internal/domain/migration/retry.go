@@ -0,0 +1,102 @@
+package migration
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-ozzo/ozzo-validation/v4"
+)
+
+const (
+	// SQLStateSerializationFailure - the transaction is rolled back because of concurrent updates
+	SQLStateSerializationFailure	= "40001"
+	// SQLStateDeadlockDetected - the transaction is rolled back to resolve a deadlock
+	SQLStateDeadlockDetected		= "40P01"
+	// SQLStateClassConnection - the class of connection exceptions, e.g. a dropped connection
+	SQLStateClassConnection			= "08"
+	// SQLStateConnectionFailure - the connection is dropped
+	SQLStateConnectionFailure		= "08006"
+)
+
+// DefaultRetryClasses are SQLSTATE classes and codes of transient errors that are retried by default
+var DefaultRetryClasses = []string{SQLStateSerializationFailure, SQLStateDeadlockDetected, SQLStateClassConnection}
+
+// defaultRetryBackoff is the delay before the first retry by default
+const defaultRetryBackoff = 100 * time.Millisecond
+
+// maxRetryBackoff is the max delay before a retry
+const maxRetryBackoff = time.Minute
+
+// sqlStateRegexp matches a SQLSTATE class (2 chars) or code (5 chars)
+var sqlStateRegexp = regexp.MustCompile("^[0-9A-Z]{2}([0-9A-Z]{3})?$")
+
+// RetryPolicy is a policy of retries of transactions of migrations failed by transient errors.
+// A migration is retried only if it is executed in its own transaction, that is rolled back on a failure.
+// A failure of commit by a dropped connection is retried only for idempotent migrations, because the transaction may be committed.
+type RetryPolicy struct {
+	// MaxAttempts is the max number of attempts of execution including the first one, retries are off if it is less than 2
+	MaxAttempts	int
+	// Backoff is the delay before the first retry, it is doubled for each next one, 100ms by default
+	Backoff		time.Duration
+	// Classes are SQLSTATE classes (e.g. "40") or codes (e.g. "40001") of retryable errors, DefaultRetryClasses by default
+	Classes		[]string
+}
+
+// Validate method
+func (p RetryPolicy) Validate() error {
+	return validation.ValidateStruct(&p,
+		validation.Field(&p.MaxAttempts, validation.Min(0)),
+		validation.Field(&p.Backoff, validation.Min(time.Duration(0))),
+		validation.Field(&p.Classes, validation.Each(validation.Match(sqlStateRegexp))),
+	)
+}
+
+// Retryable returns true if an error with the SQLSTATE code is retryable by the policy
+func (p RetryPolicy) Retryable(code string) bool {
+	if p.MaxAttempts < 2 || code == "" {
+		return false
+	}
+	classes := p.Classes
+	if len(classes) == 0 {
+		classes = DefaultRetryClasses
+	}
+
+	for _, c := range classes {
+		if strings.HasPrefix(code, c) {
+			return true
+		}
+	}
+	return false
+}
+
+// Delay returns the delay before the retry after the attempt, it is limited by a minute
+func (p RetryPolicy) Delay(attempt int) time.Duration {
+	delay := p.Backoff
+	if delay <= 0 {
+		delay = defaultRetryBackoff
+	}
+
+	for i := 1; i < attempt && delay < maxRetryBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryBackoff {
+		delay = maxRetryBackoff
+	}
+	return delay
+}
+
+// idempotentKey is the key of the context value of idempotency of the executed migration
+type idempotentKey struct{}
+
+// WithIdempotent returns the context for execution of a migration with its idempotency
+func WithIdempotent(ctx context.Context, idempotent bool) context.Context {
+	return context.WithValue(ctx, idempotentKey{}, idempotent)
+}
+
+// IsIdempotent returns true if the migration executed with the context is idempotent
+func IsIdempotent(ctx context.Context) bool {
+	idempotent, _ := ctx.Value(idempotentKey{}).(bool)
+	return idempotent
+}
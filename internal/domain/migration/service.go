@@ -2,9 +2,13 @@ package migration
 
 import (
 	"context"
+	"fmt"
 	"io"
+	"log/slog"
+	"path/filepath"
 	"sort"
 	"text/template"
+	"time"
 
 	"github.com/pkg/errors"
 
@@ -39,18 +43,41 @@ type IService interface {
 	Down(ctx context.Context, ms MigrationsList, quantity int) error
 	// Redo a last migration
 	Redo(ctx context.Context, ms MigrationsList) error
+	// Goto applies or reverts migrations to make the migration with the ID the last applied one, it is not atomic
+	Goto(ctx context.Context, ms MigrationsList, id uint) error
+	// Plan returns logs of migrations that are not applied yet in order of application
+	Plan(ctx context.Context, ms MigrationsList) ([]Log, error)
+	// PlanRepeatable returns logs of repeatable migrations whose checksums differ from the saved ones, their IDs are 0
+	PlanRepeatable(ctx context.Context, rs RepeatablesList) ([]Log, error)
+	// UpRepeatable applies repeatable migrations whose checksums differ from the saved ones, it returns the number of applied migrations
+	UpRepeatable(ctx context.Context, rs RepeatablesList) (int, error)
+	// Graph writes the dependency graph of migrations in DOT format
+	Graph(ctx context.Context, ms MigrationsList, wr io.Writer) error
 	// Last returns a last Log
 	Last(ctx context.Context) (*Log, error)
+	// Missing returns logs of migrations that are saved in DB but not represented in a list of migrations
+	Missing(ctx context.Context, ms MigrationsList) (LogsList, error)
+	// Prune deletes logs of migrations that are saved in DB but not represented in a list of migrations
+	Prune(ctx context.Context, ms MigrationsList) (LogsList, error)
+	// Validate a list of migrations
+	Validate(ctx context.Context, ms MigrationsList) []error
+	// NextID returns an ID for a new migration according to the ID scheme
+	NextID(ctx context.Context, existingIDs []int) (uint, error)
+	// FileName returns a file name (without extension) for a new migration
+	FileName(ctx context.Context, p CreateParams) string
 	// Create creates a file for migration
 	Create(ctx context.Context, wr io.Writer, p CreateParams) (err error)
+	// CreateSQL creates files of up and down SQL for migration
+	CreateSQL(ctx context.Context, upWr io.Writer, downWr io.Writer, p CreateParams) (err error)
 	// Create creates a main file for migrations execution
 	CreateMainFile(ctx context.Context, wr io.Writer) (err error)
 }
 
 // Service stgruct
 type Service struct {
-	repo   IRepository
-	logger app.Logger
+	repo		IRepository
+	logger		*slog.Logger
+	options		Options
 }
 
 var _ IService = (*Service)(nil)
@@ -59,8 +86,8 @@ var _ IService = (*Service)(nil)
 const DefaultDownQuantity = 1
 
 // NewService creates a new Service.
-func NewService(repo IRepository, logger app.Logger) *Service {
-	s := &Service{repo, logger}
+func NewService(repo IRepository, logger app.Logger, options Options) *Service {
+	s := &Service{repo, app.Slog(logger), options}
 	return s
 }
 
@@ -122,7 +149,20 @@ func (s Service) Delete(ctx context.Context, id uint) error {
 
 // CreateTable creates table for migration
 func (s Service) CreateTable(ctx context.Context) error {
-	return s.repo.ExecSQL(ctx, SQLCreateTable)
+	if err := s.repo.ExecSQL(ctx, SQLCreateTable); err != nil {
+		return err
+	}
+
+	if err := s.repo.ExecSQL(ctx, SQLCreateRepeatableTable); err != nil {
+		return err
+	}
+
+	for _, sql := range SQLUpgradeTable {
+		if err := s.repo.ExecSQL(ctx, sql); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // Last returns a last Log
@@ -134,7 +174,7 @@ func (s Service) Last(ctx context.Context) (*Log, error) {
 	})
 
 	if err != nil {
-		if errors.Is(err, apperror.ErrNotFound) {
+		if errors.Is(err, apperror.ErrNotFound) || errors.Is(err, apperror.ErrNoTable) {
 			return nil, err
 		}
 		return nil, errors.Wrapf(apperror.ErrInternal, "migration.Service.Last error: %v", err)
@@ -142,41 +182,132 @@ func (s Service) Last(ctx context.Context) (*Log, error) {
 	return mLog, nil
 }
 
+// Missing returns logs of migrations that are saved in DB but not represented in a list of migrations
+func (s Service) Missing(ctx context.Context, ms MigrationsList) (LogsList, error) {
+	list, err := s.repo.Query(ctx, 0, 0)
+	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return make(LogsList), nil
+		}
+		return nil, errors.Wrapf(apperror.ErrInternal, "migration.Service.Missing: get list logs of migrations error: %v", err)
+	}
+
+	return MigrationsLogsFilterExceptByMigrations(LogsSlice(list).List(), ms), nil
+}
+
+// Prune deletes logs of migrations that are saved in DB but not represented in a list of migrations
+func (s Service) Prune(ctx context.Context, ms MigrationsList) (LogsList, error) {
+	t, err := s.repo.BeginTx(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "migration.Service.Prune: transaction begin error")
+	}
+
+	list, err := s.repo.QueryTx(ctx, t, nil, 0, 0)
+	if err != nil && !errors.Is(err, apperror.ErrNotFound) {
+		if er := t.Rollback(); er != nil {
+			return nil, errors.Wrapf(er, "migration.Service.Prune: transaction rollback error")
+		}
+		return nil, errors.Wrapf(apperror.ErrInternal, "migration.Service.Prune: get list logs of migrations error: %v", err)
+	}
+
+	missingMigrationsLogs := MigrationsLogsFilterExceptByMigrations(LogsSlice(list).List(), ms)
+
+	err = s.repo.BatchDeleteTx(ctx, t, missingMigrationsLogs)
+	if err != nil {
+		if er := t.Rollback(); er != nil {
+			return nil, errors.Wrapf(er, "migration.Service.Prune: transaction rollback error")
+		}
+		return nil, errors.Wrapf(err, "migration.Service.Prune: batch delete error")
+	}
+
+	err = t.Commit()
+	if err != nil {
+		return nil, errors.Wrapf(err, "migration.Service.Prune: transaction commit error")
+	}
+
+	for id := range missingMigrationsLogs {
+		s.logger.Info("migration log pruned", "migration_id", id)
+	}
+	return missingMigrationsLogs, nil
+}
+
 // Up a list of migrations
 func (s Service) Up(ctx context.Context, ms MigrationsList, quantity int) error {
+	return s.up(ctx, ms, func(ids []int) []int {
+		if quantity < 1 || len(ids) < quantity {
+			return ids
+		}
+		return ids[:quantity]
+	})
+}
+
+// up applies migrations picked from ids of not applied migrations in order of dependencies
+func (s Service) up(ctx context.Context, ms MigrationsList, pick func(ids []int) []int) error {
 	t, err := s.repo.BeginTx(ctx)
 	if err != nil {
 		return errors.Wrapf(err, "migration.Service.Up: transaction begin error")
 	}
 
+	// no logs means that no migration is applied yet
 	list, err := s.repo.QueryTx(ctx, t, nil, 0, 0)
-	if err != nil {
-		return errors.Wrapf(apperror.ErrInternal, "migration.Service.Down: get list logs of migrations error: %v", err)
+	if err != nil && !errors.Is(err, apperror.ErrNotFound) {
+		if er := t.Rollback(); er != nil {
+			return errors.Wrapf(er, "migration.Service.Up: transaction rollback error")
+		}
+		return errors.Wrapf(apperror.ErrInternal, "migration.Service.Up: get list logs of migrations error: %v", err)
 	}
 
 	gl			:= GroupLogsByStatus(list)
 	migrations	:= MigrationsListFilterExceptByKeys(ms, gl[StatusApplied])
-	ids			:= migrations.IDs()
-	sort.Ints(ids)
+	ids, err	:= migrations.Order(migrations.IDs())
+	if err != nil {
+		if er := t.Rollback(); er != nil {
+			return errors.Wrapf(er, "migration.Service.Up: transaction rollback error")
+		}
+		return err
+	}
 
-	if quantity < 1 {
-		quantity = len(ids)
+	ids = pick(ids)
+
+	if len(ids) == 0 {
+		if er := t.Rollback(); er != nil {
+			return errors.Wrapf(er, "migration.Service.Up: transaction rollback error")
+		}
+		return apperror.ErrNotFound
 	}
 
-	if len(ids) < quantity {
-		quantity = len(ids)
+	if err = s.checkOutOfOrder(gl[StatusApplied], ids); err != nil {
+		if er := t.Rollback(); er != nil {
+			return errors.Wrapf(er, "migration.Service.Up: transaction rollback error")
+		}
+		return err
 	}
 
-	if quantity == 0 {
-		return apperror.ErrNotFound
+	if err = s.checkDependencies(ctx, t, migrations, gl[StatusApplied], ids); err != nil {
+		if er := t.Rollback(); er != nil {
+			return errors.Wrapf(er, "migration.Service.Up: transaction rollback error")
+		}
+		return err
+	}
+
+	run, err := s.session(ctx, HookInfo{Direction: DirectionUp})
+	if err != nil {
+		if er := t.Rollback(); er != nil {
+			return errors.Wrapf(er, "migration.Service.Up: transaction rollback error")
+		}
+		s.onError(ctx, HookInfo{Direction: DirectionUp}, err)
+		return err
 	}
+	defer run.close()
 
-	appliedMigrationsLogs, idErr, err := s.upProceed(ctx, migrations, ids[:quantity])
+	appliedMigrationsLogs, idErr, er := run.upProceed(ctx, migrations, ids)
 
 	migrationsLogsForUpdate	:= MigrationsLogsFilterExistsByKeys(appliedMigrationsLogs, gl[StatusNotApplied])
 	migrationsLogsForCreate := MigrationsLogsFilterExceptByKeys(appliedMigrationsLogs, gl[StatusNotApplied])
 
-	if err != nil {
+	if er != nil {
+		run.onError(ctx, migrations[idErr].hookInfo(DirectionUp), er)
+
 		if mLog, ok := gl[StatusNotApplied][idErr]; ok {
 			mLog.Status = StatusError
 			migrationsLogsForUpdate[idErr] = mLog
@@ -208,11 +339,194 @@ func (s Service) Up(ctx context.Context, ms MigrationsList, quantity int) error
 		return errors.Wrapf(err, "migration.Service.Up: transaction commit error")
 	}
 
+	if er != nil {
+		return er
+	}
+	return run.afterAll(ctx, DirectionUp)
+}
+
+// UpRepeatable applies repeatable migrations whose checksums differ from the saved ones in order of names, it returns the number of applied migrations
+func (s Service) UpRepeatable(ctx context.Context, rs RepeatablesList) (int, error) {
+	if len(rs) == 0 {
+		return 0, nil
+	}
+
+	sums, err := s.repeatableSums(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var count int
+
+	for _, name := range rs.Names() {
+		r := rs[name]
+		if sums[name] == r.Sum() {
+			s.skip(DirectionUp, r.Migration())
+			continue
+		}
+
+		t, err := s.repo.BeginTx(ctx)
+		if err != nil {
+			return count, errors.Wrapf(err, "migration.Service.UpRepeatable: transaction begin error")
+		}
+
+		err = s.observe(DirectionUp, r.Migration(), func() error {
+			if err := s.actionExecTx(ctx, t, r.Up); err != nil {
+				return err
+			}
+			return s.repo.SaveRepeatableTx(ctx, t, r.Log())
+		})
+		if err != nil {
+			if er := t.Rollback(); er != nil {
+				return count, errors.Wrapf(er, "migration.Service.UpRepeatable: transaction rollback error")
+			}
+			return count, errors.Wrapf(err, "up error on repeatable migration %q", name)
+		}
+
+		if err = t.Commit(); err != nil {
+			return count, errors.Wrapf(err, "migration.Service.UpRepeatable: transaction commit error")
+		}
+		count++
+	}
+	return count, nil
+}
+
+// PlanRepeatable returns logs of repeatable migrations whose checksums differ from the saved ones in order of application, their IDs are 0
+func (s Service) PlanRepeatable(ctx context.Context, rs RepeatablesList) ([]Log, error) {
+	if len(rs) == 0 {
+		return nil, nil
+	}
+
+	sums, err := s.repeatableSums(ctx)
+	// all repeatable migrations are pending if there is no history table yet
+	if err != nil && !errors.Is(err, apperror.ErrNoTable) {
+		return nil, err
+	}
+	var plan []Log
+
+	for _, name := range rs.Names() {
+		if sums[name] != rs[name].Sum() {
+			plan = append(plan, Log{Name: name, Status: StatusNotApplied})
+		}
+	}
+	return plan, nil
+}
+
+// repeatableSums returns saved checksums of repeatable migrations by names
+func (s Service) repeatableSums(ctx context.Context) (map[string]string, error) {
+	list, err := s.repo.QueryRepeatable(ctx)
+	if err != nil && !errors.Is(err, apperror.ErrNotFound) {
+		if errors.Is(err, apperror.ErrNoTable) {
+			return nil, err
+		}
+		return nil, errors.Wrapf(apperror.ErrInternal, "migration.Service: get list logs of repeatable migrations error: %v", err)
+	}
+	sums := make(map[string]string, len(list))
+
+	for _, l := range list {
+		sums[l.Name] = l.Checksum
+	}
+	return sums, nil
+}
+
+// Plan returns logs of migrations that are not applied yet in order of application
+func (s Service) Plan(ctx context.Context, ms MigrationsList) ([]Log, error) {
+	list, err := s.repo.Query(ctx, 0, 0)
+	// all migrations are pending if there is no history table yet
+	if err != nil && !errors.Is(err, apperror.ErrNotFound) && !errors.Is(err, apperror.ErrNoTable) {
+		return nil, errors.Wrapf(apperror.ErrInternal, "migration.Service.Plan: get list logs of migrations error: %v", err)
+	}
+
+	gl			:= GroupLogsByStatus(list)
+	migrations	:= MigrationsListFilterExceptByKeys(ms, gl[StatusApplied])
+	ids, err	:= migrations.Order(migrations.IDs())
+	if err != nil {
+		return nil, err
+	}
+	plan		:= make([]Log, 0, len(ids))
+
+	for _, id := range ids {
+		plan = append(plan, *migrations[uint(id)].Log(StatusNotApplied))
+	}
+	return plan, nil
+}
+
+// Graph writes the dependency graph of migrations in DOT format
+func (s Service) Graph(ctx context.Context, ms MigrationsList, wr io.Writer) error {
+	if err := ms.WriteGraph(wr); err != nil {
+		return errors.Wrapf(apperror.ErrInternal, "migration.Service.Graph: write error: %v", err)
+	}
+	return nil
+}
+
+// Goto applies or reverts migrations to make the migration with the ID the last applied one, ID 0 reverts all migrations.
+// Goto is not atomic: reverting and applying are separate runs, so on a failure migrations stay reverted or applied up to the failed one,
+// the last applied migration is reported in the error.
+func (s Service) Goto(ctx context.Context, ms MigrationsList, id uint) error {
+	if _, ok := ms[id]; !ok && id != 0 {
+		return errors.Wrapf(apperror.ErrNotFound, "migration.Service.Goto: can not find migration #%v", id)
+	}
+
+	// migrations after the target are reverted, then not applied migrations up to the target are applied
+	err := s.down(ctx, ms, func(ids []int) []int {
+		return filterIDs(ids, func(i int) bool { return uint(i) > id })
+	})
+	if err != nil && !errors.Is(err, apperror.ErrNotFound) {
+		return errors.Wrapf(err, "migration.Service.Goto: reverting of migrations after #%v is failed, the last applied migration is %v", id, s.lastApplied(ctx))
+	}
+
+	err = s.up(ctx, ms, func(ids []int) []int {
+		return filterIDs(ids, func(i int) bool { return uint(i) <= id })
+	})
+	if err != nil && !errors.Is(err, apperror.ErrNotFound) {
+		return errors.Wrapf(err, "migration.Service.Goto: migrations after #%v are reverted, but applying of migrations up to it is failed, the last applied migration is %v", id, s.lastApplied(ctx))
+	}
 	return nil
 }
 
+// lastApplied returns the last applied migration for messages of errors
+func (s Service) lastApplied(ctx context.Context) string {
+	mLog, err := s.repo.Last(ctx, &QueryCondition{
+		Where:	&WhereCondition{
+			Status:	StatusApplied,
+		},
+	})
+	switch {
+	case errors.Is(err, apperror.ErrNotFound):
+		return "none"
+	case err != nil:
+		return "unknown"
+	}
+	return fmt.Sprintf("#%v", mLog.ID)
+}
+
+// filterIDs returns ids that match the condition keeping their order
+func filterIDs(ids []int, match func(id int) bool) []int {
+	res := make([]int, 0, len(ids))
+
+	for _, id := range ids {
+		if match(id) {
+			res = append(res, id)
+		}
+	}
+	return res
+}
+
 // Down a list of migrations
 func (s Service) Down(ctx context.Context, ms MigrationsList, quantity int) error {
+	if quantity < 1 {
+		quantity = DefaultDownQuantity
+	}
+
+	return s.down(ctx, ms, func(ids []int) []int {
+		if len(ids) < quantity {
+			return ids
+		}
+		return ids[:quantity]
+	})
+}
+
+// down reverts migrations picked from ids of applied migrations in reverse order of dependencies
+func (s Service) down(ctx context.Context, ms MigrationsList, pick func(ids []int) []int) error {
 	t, err := s.repo.BeginTx(ctx)
 	if err != nil {
 		return errors.Wrapf(err, "migration.Service.Down: transaction begin error")
@@ -220,6 +534,9 @@ func (s Service) Down(ctx context.Context, ms MigrationsList, quantity int) erro
 
 	list, err := s.repo.QueryTx(ctx, t, nil, 0, 0)
 	if err != nil {
+		if er := t.Rollback(); er != nil {
+			return errors.Wrapf(er, "migration.Service.Down: transaction rollback error")
+		}
 		if errors.Is(err, apperror.ErrNotFound) {
 			return err
 		}
@@ -228,22 +545,49 @@ func (s Service) Down(ctx context.Context, ms MigrationsList, quantity int) erro
 
 	gl			:= GroupLogsByStatus(list)
 	migrations	:= MigrationsListFilterExistsByKeys(ms, gl[StatusApplied])
-	ids			:= migrations.IDs()
-	sort.Sort(sort.Reverse(sort.IntSlice(ids)))
+	ids, err	:= migrations.Order(migrations.IDs())
+	if err != nil {
+		if er := t.Rollback(); er != nil {
+			return errors.Wrapf(er, "migration.Service.Down: transaction rollback error")
+		}
+		return err
+	}
+	// dependent migrations are reverted before their dependencies
+	for i, j := 0, len(ids) - 1; i < j; i, j = i + 1, j - 1 {
+		ids[i], ids[j] = ids[j], ids[i]
+	}
 
-	if quantity < 1 {
-		quantity = DefaultDownQuantity
+	ids = pick(ids)
+
+	if len(ids) == 0 {
+		if er := t.Rollback(); er != nil {
+			return errors.Wrapf(er, "migration.Service.Down: transaction rollback error")
+		}
+		return apperror.ErrNotFound
 	}
 
-	if len(ids) < quantity {
-		quantity = len(ids)
+	if err = s.checkDependents(migrations, ids); err != nil {
+		if er := t.Rollback(); er != nil {
+			return errors.Wrapf(er, "migration.Service.Down: transaction rollback error")
+		}
+		return err
 	}
 
-	if quantity == 0 {
-		return apperror.ErrNotFound
+	run, err := s.session(ctx, HookInfo{Direction: DirectionDown})
+	if err != nil {
+		if er := t.Rollback(); er != nil {
+			return errors.Wrapf(er, "migration.Service.Down: transaction rollback error")
+		}
+		s.onError(ctx, HookInfo{Direction: DirectionDown}, err)
+		return err
 	}
+	defer run.close()
 
-	migrationsLogsForUpdate, _, er := s.downProceed(ctx, migrations, ids[:quantity])
+	migrationsLogsForUpdate, idErr, er := run.downProceed(ctx, migrations, ids)
+
+	if er != nil {
+		run.onError(ctx, migrations[idErr].hookInfo(DirectionDown), er)
+	}
 
 	err = s.repo.BatchUpdateTx(ctx, t, migrationsLogsForUpdate)
 	if err != nil {
@@ -259,22 +603,50 @@ func (s Service) Down(ctx context.Context, ms MigrationsList, quantity int) erro
 		return errors.Wrapf(err, "migration.Service.Down: transaction commit error")
 	}
 
-	return er
+	if er != nil {
+		return er
+	}
+	return run.afterAll(ctx, DirectionDown)
 }
 
 // Redo a last migration
 func (s Service) Redo(ctx context.Context, ms MigrationsList) error {
+	// the last migration is checked before beforeAll hooks are run, it is read again in the transaction of the run
+	mLog, err := s.repo.Last(ctx, &QueryCondition{
+		Where:	&WhereCondition{
+			Status:	StatusApplied,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	if _, ok := ms[mLog.ID]; !ok {
+		return errors.Wrapf(apperror.ErrNotFound, "migration.Service.Redo: can not find last migration #%v", mLog.ID)
+	}
+
+	run, err := s.session(ctx, HookInfo{Direction: DirectionRedo})
+	if err != nil {
+		s.onError(ctx, HookInfo{Direction: DirectionRedo}, err)
+		return err
+	}
+	defer run.close()
+	s = run
+
 	t, err := s.repo.BeginTx(ctx)
 	if err != nil {
 		return errors.Wrapf(err, "migration.Service.Redo: transaction begin error")
 	}
 
-	mLog, err := s.repo.LastTx(ctx, t, &QueryCondition{
+	mLog, err = s.repo.LastTx(ctx, t, &QueryCondition{
 		Where:	&WhereCondition{
 			Status:	StatusApplied,
 		},
 	})
 	if err != nil {
+		if er := t.Rollback(); er != nil {
+			return errors.Wrapf(er, "migration.Service.Redo: transaction rollback error")
+		}
 		if errors.Is(err, apperror.ErrNotFound) {
 			return err
 		}
@@ -283,51 +655,136 @@ func (s Service) Redo(ctx context.Context, ms MigrationsList) error {
 
 	m, ok := ms[mLog.ID]
 	if !ok {
+		if er := t.Rollback(); er != nil {
+			return errors.Wrapf(er, "migration.Service.Redo: transaction rollback error")
+		}
 		return errors.Wrapf(apperror.ErrNotFound, "migration.Service.Redo: can not find last migration #%v", mLog.ID)
 	}
 
-	err = s.actionExecTx(ctx, t, m.Down)
+	err = s.observe(DirectionDown, m, func() error {
+		return s.execTx(ctx, t, DirectionDown, m, m.Down)
+	})
 	if err != nil {
-		err = t.Rollback()
-		if err != nil {
-			return errors.Wrapf(err, "migration.Service.Redo: transaction rollback error")
+		if er := t.Rollback(); er != nil {
+			return errors.Wrapf(er, "migration.Service.Redo: transaction rollback error")
 		}
-		s.logger.Print("down #", m.ID, " - error: ", err)
+		s.onError(ctx, m.hookInfo(DirectionRedo), err)
 		return errors.Wrapf(err, "migration.Service.Redo: error on down a migration #%v", mLog.ID)
 	}
-	s.logger.Print("down #", m.ID, " - done")
 
-	err = s.actionExecTx(ctx, t, m.Up)
+	err = s.observe(DirectionUp, m, func() error {
+		return s.execTx(ctx, t, DirectionUp, m, m.Up)
+	})
 	if err != nil {
-		err = t.Rollback()
-		if err != nil {
-			return errors.Wrapf(err, "migration.Service.Redo: transaction rollback error")
+		if er := t.Rollback(); er != nil {
+			return errors.Wrapf(er, "migration.Service.Redo: transaction rollback error")
 		}
-		s.logger.Print("up #", m.ID, " - error: ", err)
+		s.onError(ctx, m.hookInfo(DirectionRedo), err)
 		return errors.Wrapf(err, "migration.Service.Redo: error on up a migration #%v", mLog.ID)
 	}
-	s.logger.Print("up #", m.ID, " - done")
 
 	err = t.Commit()
 	if err != nil {
 		return errors.Wrapf(err, "migration.Service.Redo: transaction commit error")
 	}
 
+	return s.afterAll(ctx, DirectionRedo)
+}
+
+// checkOutOfOrder checks ids of migrations for applying against the last applied migration according to the out-of-order policy
+func (s Service) checkOutOfOrder(appliedMigrationsLogs LogsList, ids []int) error {
+	var lastAppliedID int
+	var outOfOrderIDs []int
+
+	for _, id := range appliedMigrationsLogs.IDs() {
+		if id > lastAppliedID {
+			lastAppliedID = id
+		}
+	}
+
+	for _, id := range ids {
+		if id < lastAppliedID {
+			outOfOrderIDs = append(outOfOrderIDs, id)
+		}
+	}
+
+	if len(outOfOrderIDs) == 0 {
+		return nil
+	}
+
+	switch s.options.OutOfOrder {
+	case OutOfOrderReject:
+		return errors.Wrapf(apperror.ErrOutOfOrder, "migration.Service.Up: migrations %v are older than the last applied migration #%v", outOfOrderIDs, lastAppliedID)
+	case OutOfOrderWarn:
+		s.logger.Warn("migrations are older than the last applied migration", "migration_ids", outOfOrderIDs, "last_applied_id", lastAppliedID)
+	}
+	return nil
+}
+
+// checkDependencies checks that dependencies of migrations for applying are applied or are applied before them
+func (s Service) checkDependencies(ctx context.Context, t Transaction, ms MigrationsList, appliedMigrationsLogs LogsList, ids []int) error {
+	planned := make(map[uint]bool, len(ids))
+
+	for _, id := range ids {
+		m := ms[uint(id)]
+
+		for _, d := range m.DependsOn {
+			if d.IsLocal(m) {
+				if _, ok := appliedMigrationsLogs[d.ID]; !ok && !planned[d.ID] {
+					return errors.Wrapf(apperror.ErrBadRequest, "migration.Service.Up: migration #%v depends on migration #%v that is not applied", m.ID, d.ID)
+				}
+				continue
+			}
+
+			applied, err := s.repo.IsAppliedTx(ctx, t, d.Namespace, d.ID)
+			if err != nil {
+				return errors.Wrapf(apperror.ErrInternal, "migration.Service.Up: check of dependency %v error: %v", d, err)
+			}
+			if !applied {
+				return errors.Wrapf(apperror.ErrBadRequest, "migration.Service.Up: migration #%v depends on migration %v that is not applied", m.ID, d)
+			}
+		}
+		planned[m.ID] = true
+	}
 	return nil
 }
 
+// checkDependents checks that applied migrations that are not reverted do not depend on migrations for reverting
+func (s Service) checkDependents(applied MigrationsList, ids []int) error {
+	reverted := make(map[uint]bool, len(ids))
+
+	for _, id := range ids {
+		reverted[uint(id)] = true
+	}
+
+	for _, m := range applied {
+		if reverted[m.ID] {
+			continue
+		}
+
+		for _, d := range m.DependsOn {
+			if d.IsLocal(m) && reverted[d.ID] {
+				return errors.Wrapf(apperror.ErrBadRequest, "migration.Service.Down: migration #%v depends on migration #%v that is reverted", m.ID, d.ID)
+			}
+		}
+	}
+	return nil
+}
 
 func (s Service) upProceed(ctx context.Context, ms MigrationsList, ids []int) (appliedMigrationsLogs LogsList, idErr uint, err error) {
 	appliedMigrationsLogs = make(LogsList, len(ids))
 
-	for _, i := range ids {
+	for n, i := range ids {
 		id := uint(i)
-		err = s.actionExec(ctx, ms[id].Up)
+		err = s.observe(DirectionUp, ms[id], func() error {
+			return s.exec(ctx, DirectionUp, ms[id], ms[id].Up)
+		})
 		if err != nil {
-			s.logger.Print("up #", id, " - error: ", err)
+			for _, j := range ids[n + 1:] {
+				s.skip(DirectionUp, ms[uint(j)])
+			}
 			return appliedMigrationsLogs, id, errors.Wrapf(err, "up error on migration #%v", id)
 		}
-		s.logger.Print("up #", id, " - done")
 		appliedMigrationsLogs[id] = *ms[id].Log(StatusApplied)
 	}
 	return appliedMigrationsLogs, 0, nil
@@ -337,20 +794,62 @@ func (s Service) upProceed(ctx context.Context, ms MigrationsList, ids []int) (a
 func (s Service) downProceed(ctx context.Context, ms MigrationsList, ids []int) (downMigrationsLogs LogsList, idErr uint, err error) {
 	downMigrationsLogs = make(LogsList, len(ids))
 
-	for _, i := range ids {
+	for n, i := range ids {
 		id := uint(i)
-		err = s.actionExec(ctx, ms[id].Down)
+		err = s.observe(DirectionDown, ms[id], func() error {
+			return s.exec(ctx, DirectionDown, ms[id], ms[id].Down)
+		})
 		if err != nil {
-			s.logger.Print("down #", id, " - error: ", err)
-			return downMigrationsLogs, id, errors.Wrapf(err, "up error on migration #%v", id)
+			for _, j := range ids[n + 1:] {
+				s.skip(DirectionDown, ms[uint(j)])
+			}
+			return downMigrationsLogs, id, errors.Wrapf(err, "down error on migration #%v", id)
 		}
-		s.logger.Print("down #", id, " - done")
 		downMigrationsLogs[id] = *ms[id].Log(StatusNotApplied)
 	}
 	return downMigrationsLogs, 0, nil
 }
 
 
+// observe executes an action of a migration and notifies listeners about it
+func (s Service) observe(direction string, m Migration, action func() error) error {
+	statements := m.statements(direction)
+	s.options.Listeners.OnEvent(Event{
+		Type:		EventStarted,
+		ID:			m.ID,
+		Name:		m.Name,
+		Direction:	direction,
+		Statements:	statements,
+	})
+	start := time.Now()
+
+	err := action()
+	e := Event{
+		Type:		EventSucceeded,
+		ID:			m.ID,
+		Name:		m.Name,
+		Direction:	direction,
+		Statements:	statements,
+		Duration:	time.Since(start),
+	}
+	if err != nil {
+		e.Type	= EventFailed
+		e.Err	= err
+	}
+	s.options.Listeners.OnEvent(e)
+
+	return err
+}
+
+// skip notifies listeners that a migration is not executed
+func (s Service) skip(direction string, m Migration) {
+	s.options.Listeners.OnEvent(Event{
+		Type:		EventSkipped,
+		ID:			m.ID,
+		Name:		m.Name,
+		Direction:	direction,
+	})
+}
 
 func (s Service) actionExec(ctx context.Context, in interface{}) (err error) {
 
@@ -381,42 +880,145 @@ func (s Service) actionExecTx(ctx context.Context, t Transaction, in interface{}
 	return err
 }
 
+// Validate a list of migrations
+func (s Service) Validate(ctx context.Context, ms MigrationsList) (errs []error) {
+	ids := ms.IDs()
+	sort.Ints(ids)
+
+	for _, id := range ids {
+		m := ms[uint(id)]
+		if err := m.Validate(); err != nil {
+			errs = append(errs, errors.Wrapf(apperror.ErrInvalid, "Invalid migration #%v: %v", id, err))
+		}
+
+		for _, a := range []struct {
+			direction	string
+			action		interface{}
+		}{{DirectionUp, m.Up}, {DirectionDown, m.Down}} {
+			if sql, ok := a.action.(string); ok && isBlankSQL(sql) {
+				errs = append(errs, errors.Wrapf(apperror.ErrInvalid, "Invalid migration #%v: %v: cannot be blank", id, a.direction))
+			}
+		}
+	}
+
+	for _, id := range ids {
+		m := ms[uint(id)]
+
+		for _, d := range m.DependsOn {
+			if _, ok := ms[d.ID]; d.IsLocal(m) && !ok {
+				errs = append(errs, errors.Wrapf(apperror.ErrInvalid, "Migration #%v depends on unknown migration #%v", id, d.ID))
+			}
+		}
+	}
+
+	if _, err := ms.Order(ids); err != nil {
+		errs = append(errs, err)
+	}
+
+	if s.options.DisallowGaps {
+		for _, gap := range ms.Gaps() {
+			errs = append(errs, errors.Wrapf(apperror.ErrInvalid, "Gap in IDs of migrations between #%v and #%v", gap[0], gap[1]))
+		}
+	}
+	return errs
+}
+
+// NextID returns an ID for a new migration according to the ID scheme
+func (s Service) NextID(ctx context.Context, existingIDs []int) (uint, error) {
+	var id uint
+
+	for _, i := range existingIDs {
+		if uint(i) >= id {
+			id = uint(i) + 1
+		}
+	}
+
+	if s.options.IDScheme == IDSchemeTimestamp {
+		ts, err := TimestampID(time.Now())
+		if err != nil {
+			return 0, err
+		}
+		if ts > id {
+			id = ts
+		}
+	} else if id == 0 {
+		id = 1
+	}
+	return id, nil
+}
+
+// FileName returns a file name (without extension) for a new migration
+func (s Service) FileName(ctx context.Context, p CreateParams) string {
+	return fmt.Sprintf("%0*d_%s", IDWidth(s.options.IDScheme), p.ID, p.Name)
+}
+
 // Create creates a file for migration
 func (s Service) Create(ctx context.Context, wr io.Writer, p CreateParams) (err error) {
 	if err = p.Validate(); err != nil {
 		return errors.Wrapf(err, "Invalid create params")
 	}
 
-	return s.getTemplate().ExecuteTemplate(wr, "tpl", p)
+	return s.executeTemplate(wr, s.options.Templates.Go, goTemplate, p)
+}
+
+// CreateSQL creates files of up and down SQL for migration
+func (s Service) CreateSQL(ctx context.Context, upWr io.Writer, downWr io.Writer, p CreateParams) (err error) {
+	if err = p.Validate(); err != nil {
+		return errors.Wrapf(err, "Invalid create params")
+	}
+
+	if err = s.executeTemplate(upWr, s.options.Templates.SQLUp, sqlUpTemplate, p); err != nil {
+		return err
+	}
+	return s.executeTemplate(downWr, s.options.Templates.SQLDown, sqlDownTemplate, p)
+}
+
+// executeTemplate executes a template from the file if fileName is set, otherwise the builtin one
+func (s Service) executeTemplate(wr io.Writer, fileName string, builtin string, p CreateParams) (err error) {
+	if fileName == "" {
+		return template.Must(template.New("tpl").Parse(builtin)).ExecuteTemplate(wr, "tpl", p)
+	}
+
+	tpl, err := template.ParseFiles(fileName)
+	if err != nil {
+		return errors.Wrapf(apperror.ErrBadRequest, "Can not parse template file %q: %v", fileName, err)
+	}
+	return tpl.ExecuteTemplate(wr, filepath.Base(fileName), p)
 }
 
-func (s Service) getTemplate() (*template.Template) {
-	return template.Must(template.New("tpl").Parse(`
+const goTemplate = `
 package migration
 
 import (
-	"github.com/Kalinin-Andrey/dbmigrator/pkg/sqlmigrator"
-	"github.com/Kalinin-Andrey/dbmigrator/pkg/sqlmigrator/api"{{if (eq .Type "go")}}
-	"github.com/jmoiron/sqlx"{{end}}
+	"github.com/Kalinin-Andrey/dbmigrator/pkg/dbmigrator"
+	"github.com/Kalinin-Andrey/dbmigrator/pkg/dbmigrator/api"
+	"github.com/jmoiron/sqlx"
 )
 
 func init() {
-	sqlmigrator.Add(api.Migration{
+	dbmigrator.Add(api.Migration{
 		ID:		{{.ID}},
 		Name:	"{{.Name}}",
-		Up:		{{if (eq .Type "sql")}}""{{else}}api.MigrationFunc(func(tx *sqlx.Tx) error {
+		Up:		api.MigrationFunc(func(tx *sqlx.Tx) error {
 			_, err := tx.Exec("CREATE TABLE IF NOT EXISTS public.test01(id int4)")	// for example
 			return err
-		}){{end}},
-		Down:	{{if (eq .Type "sql")}}""{{else}}api.MigrationFunc(func(tx *sqlx.Tx) error {
+		}),
+		Down:	api.MigrationFunc(func(tx *sqlx.Tx) error {
 			_, err := tx.Exec("DROP TABLE public.test01")							// for example
 			return err
-		}){{end}},
+		}),
 	})
 }
 
-`))
-}
+`
+
+const sqlUpTemplate = `-- Migration #{{.ID}} {{.Name}}: up
+
+`
+
+const sqlDownTemplate = `-- Migration #{{.ID}} {{.Name}}: down
+
+`
 
 // CreateMainFile here is dummy. Redefined in ServiceTool.
 func (s Service) CreateMainFile(ctx context.Context, wr io.Writer) (err error) {
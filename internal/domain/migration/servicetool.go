@@ -2,9 +2,7 @@ package migration
 
 import (
 	"context"
-	"fmt"
 	"io"
-	"text/template"
 
 	"github.com/pkg/errors"
 )
@@ -25,9 +23,15 @@ func NewServiceTool(is IService) (*ServiceTool, error) {
 	return &ServiceTool{s}, nil
 }
 
+// MainFileVersion is the version of a main file, it is increased on each change of the main file
+const MainFileVersion = "5"
+
+// MainFileHeader is the first line of a main file generated by the current version
+const MainFileHeader = "// dbmigrator main v" + MainFileVersion
+
 // CreateMainFile creates a main file for migrations execution
 func (s ServiceTool) CreateMainFile(ctx context.Context, wr io.Writer) (err error) {
-	_, err = fmt.Fprint(wr, mainFileContent)
+	_, err = io.WriteString(wr, mainFileContent)
 	return err
 }
 
@@ -37,38 +41,38 @@ func (s ServiceTool) Create(ctx context.Context, wr io.Writer, p CreateParams) (
 		return errors.Wrapf(err, "Invalid create params")
 	}
 
-	return s.getTemplate().ExecuteTemplate(wr, "tpl", p)
+	return s.executeTemplate(wr, s.options.Templates.Go, goToolTemplate, p)
 }
 
-func (s ServiceTool) getTemplate() (*template.Template) {
-	return template.Must(template.New("tpl").Parse(`
+const goToolTemplate = `
 package main
 
 import (
-	"github.com/Kalinin-Andrey/dbmigrator/pkg/sqlmigrator"
-	"github.com/Kalinin-Andrey/dbmigrator/pkg/sqlmigrator/api"{{if (eq .Type "go")}}
-	"github.com/jmoiron/sqlx"{{end}}
+	"github.com/Kalinin-Andrey/dbmigrator/pkg/dbmigrator"
+	"github.com/Kalinin-Andrey/dbmigrator/pkg/dbmigrator/api"
+	"github.com/jmoiron/sqlx"
 )
 
 func init() {
-	sqlmigrator.Add(api.Migration{
+	dbmigrator.Add(api.Migration{
 		ID:		{{.ID}},
 		Name:	"{{.Name}}",
-		Up:		{{if (eq .Type "sql")}}""{{else}}api.MigrationFunc(func(tx *sqlx.Tx) error {
+		Up:		api.MigrationFunc(func(tx *sqlx.Tx) error {
 			_, err := tx.Exec("CREATE TABLE IF NOT EXISTS public.test01(id int4)")	// for example
 			return err
-		}){{end}},
-		Down:	{{if (eq .Type "sql")}}""{{else}}api.MigrationFunc(func(tx *sqlx.Tx) error {
+		}),
+		Down:	api.MigrationFunc(func(tx *sqlx.Tx) error {
 			_, err := tx.Exec("DROP TABLE public.test01")							// for example
 			return err
-		}){{end}},
+		}),
 	})
 }
 
-`))
-}
+`
 
-const mainFileContent = `package main
+const mainFileContent = MainFileHeader + `
+
+package main
 
 import (
 	"context"
@@ -76,6 +80,9 @@ import (
 	"fmt"
 	"github.com/pkg/errors"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/Kalinin-Andrey/dbmigrator/pkg/dbmigrator"
 	"github.com/Kalinin-Andrey/dbmigrator/pkg/dbmigrator/api"
@@ -85,30 +92,83 @@ const (
 	actionUp		= "up"
 	actionDown		= "down"
 	actionRedo		= "redo"
+	actionPrune		= "prune"
+	actionValidate	= "validate"
+	actionStatus	= "status"
+	actionPlan		= "plan"
+	actionGoto		= "goto"
+	actionGraph		= "graph"
 )
 
 type config struct {
-	dsn		string
-	action	string
+	action			string
+	ignoreMissing	bool
+	outOfOrder		string
+	disallowGaps	bool
+	readOnly		bool
+	id				uint
+	dirs			string
+	namespace		string
+	connectTimeout	time.Duration
+	retryInterval	time.Duration
+	maxAttempts		int
+	retryAttempts	int
+	retryBackoff	time.Duration
+	retryClasses	string
 }
 
 var c config
 
 func init() {
-	flag.StringVar(&c.dsn, "dsn", "", "DSN of DB connection")
 	flag.StringVar(&c.action, "action", "", "Migration action")
+	flag.BoolVar(&c.ignoreMissing, "ignore-missing", false, "Continue if applied migrations are missing from code")
+	flag.StringVar(&c.outOfOrder, "out-of-order", "", "Policy for migrations older than the last applied one")
+	flag.BoolVar(&c.disallowGaps, "disallow-gaps", false, "Forbid gaps between IDs of migrations")
+	flag.BoolVar(&c.readOnly, "read-only", false, "Do not change DB and do not create the history table")
+	flag.UintVar(&c.id, "id", 0, "ID of a migration for goto action")
+	flag.StringVar(&c.namespace, "namespace", "", "Namespace of migrations")
+	flag.StringVar(&c.dirs, "dirs", "", "Additional directories of SQL migrations separated by the OS path list separator")
+	flag.DurationVar(&c.connectTimeout, "connect-timeout", 0, "Timeout of connection to DB including all attempts")
+	flag.DurationVar(&c.retryInterval, "retry-interval", 0, "Interval between attempts of connection to DB")
+	flag.IntVar(&c.maxAttempts, "max-attempts", 0, "Max number of attempts of connection to DB")
+	flag.IntVar(&c.retryAttempts, "retry-max-attempts", 0, "Max number of attempts of a migration failed by transient errors")
+	flag.DurationVar(&c.retryBackoff, "retry-backoff", 0, "Delay before the first retry of a migration")
+	flag.StringVar(&c.retryClasses, "retry-classes", "", "SQLSTATE classes or codes of retryable errors separated by commas")
 }
 
 func main() {
 	flag.Parse()
+	var dirs []string
+	if c.dirs != "" {
+		dirs = filepath.SplitList(c.dirs)
+	}
+	var retryClasses []string
+	if c.retryClasses != "" {
+		retryClasses = strings.Split(c.retryClasses, ",")
+	}
 	conf := api.Configuration{
-		DSN:     c.dsn,
-		Dir:     ".",
+		DSN:			os.Getenv(api.EnvDSN),
+		Dir:			".",
+		Dirs:			dirs,
+		Namespace:		c.namespace,
+		ConnectTimeout:	c.connectTimeout,
+		RetryInterval:	c.retryInterval,
+		MaxAttempts:	c.maxAttempts,
+		IgnoreMissing:	c.ignoreMissing,
+		OutOfOrder:		c.outOfOrder,
+		DisallowGaps:	c.disallowGaps,
+		Offline:		c.action == actionValidate || c.action == actionGraph,
+		ReadOnly:		c.readOnly,
+		Retry:			api.RetryPolicy{
+			MaxAttempts:	c.retryAttempts,
+			Backoff:		c.retryBackoff,
+			Classes:		retryClasses,
+		},
+		Events:			os.Stdout,
 	}
 	err := dbmigrator.Init(context.Background(), conf, nil)
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		exit(err)
 	}
 
 	switch c.action {
@@ -118,13 +178,45 @@ func main() {
 		err = dbmigrator.Down(0)
 	case actionRedo:
 		err = dbmigrator.Redo()
+	case actionPrune:
+		_, err = dbmigrator.Prune()
+	case actionValidate:
+		err = dbmigrator.Validate()
+	case actionStatus:
+		// logs are written to the events output
+		_, err = dbmigrator.Status()
+	case actionPlan:
+		_, err = dbmigrator.Plan()
+	case actionGoto:
+		err = dbmigrator.Goto(c.id)
+	case actionGraph:
+		// the graph is written to the events output
+		err = dbmigrator.Graph(os.Stdout)
 	default:
 		err = errors.Errorf("Invalid action %q.", c.action)
 	}
 	if err != nil {
-		fmt.Print(err)
-		os.Exit(1)
+		exit(err)
+	}
+}
+
+func exit(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	switch {
+	case errors.Is(err, api.ErrNoTable):
+		os.Exit(api.ExitCodeNoTable)
+	case errors.Is(err, api.ErrDBUnreachable):
+		os.Exit(api.ExitCodeDBUnreachable)
+	case errors.Is(err, api.ErrLockTimeout):
+		os.Exit(api.ExitCodeLockTimeout)
+	case errors.Is(err, api.ErrNotFound):
+		os.Exit(api.ExitCodeNotFound)
+	case errors.Is(err, api.ErrUsersSQL):
+		os.Exit(api.ExitCodeMigrationFailed)
+	case errors.Is(err, api.ErrUsersFunc):
+		os.Exit(api.ExitCodeFuncFailed)
 	}
+	os.Exit(1)
 }
 
 `
@@ -0,0 +1,152 @@
+package migration
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// errBlankSQL is the error of a SQL text without statements, e.g. a generated file with comments only
+var errBlankSQL = errors.New("cannot be blank")
+
+// dollarQuoteRegexp matches an opening tag of a dollar-quoted string
+var dollarQuoteRegexp = regexp.MustCompile(`^\$([A-Za-z_][A-Za-z0-9_]*)?\$`)
+
+// checkSQL checks that the SQL text is not empty and its quotes, comments and parentheses are balanced.
+// It is a lexical check only, the syntax is checked by DB on execution.
+func checkSQL(sql string) error {
+	_, err := scanSQL(sql)
+	return err
+}
+
+// isBlankSQL returns true if the SQL text has no statements
+func isBlankSQL(sql string) bool {
+	_, err := scanSQL(sql)
+	return errors.Is(err, errBlankSQL)
+}
+
+// CountStatements returns the number of statements of the SQL text separated by semicolons, it is 0 for an invalid text
+func CountStatements(sql string) int {
+	statements, err := scanSQL(sql)
+	if err != nil {
+		return 0
+	}
+	return statements
+}
+
+// scanSQL checks the SQL text lexically and returns the number of its statements
+func scanSQL(sql string) (statements int, err error) {
+	var hasContent bool
+	var depth int
+
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+
+		switch {
+		case strings.HasPrefix(sql[i:], "--"):
+			end := strings.IndexByte(sql[i:], '\n')
+			if end < 0 {
+				i = len(sql)
+				continue
+			}
+			i += end
+		case strings.HasPrefix(sql[i:], "/*"):
+			end, err := blockCommentEnd(sql, i)
+			if err != nil {
+				return 0, err
+			}
+			i = end
+		case c == '\'':
+			hasContent = true
+			end, err := quoteEnd(sql, i, c, i > 0 && (sql[i-1] == 'E' || sql[i-1] == 'e'))
+			if err != nil {
+				return 0, errors.Wrapf(err, "unterminated string literal")
+			}
+			i = end
+		case c == '"':
+			hasContent = true
+			end, err := quoteEnd(sql, i, c, false)
+			if err != nil {
+				return 0, errors.Wrapf(err, "unterminated quoted identifier")
+			}
+			i = end
+		case c == '$':
+			hasContent = true
+			tag := dollarQuoteRegexp.FindString(sql[i:])
+			if tag == "" {
+				continue
+			}
+			end := strings.Index(sql[i+len(tag):], tag)
+			if end < 0 {
+				return 0, errors.Errorf("unterminated dollar-quoted string %s at position %v", tag, i)
+			}
+			i += len(tag) + end + len(tag) - 1
+		case c == '(':
+			hasContent = true
+			depth++
+		case c == ')':
+			hasContent = true
+			depth--
+			if depth < 0 {
+				return 0, errors.Errorf("unexpected \")\" at position %v", i)
+			}
+		case c == ';':
+			if hasContent {
+				statements++
+			}
+			hasContent = false
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+		default:
+			hasContent = true
+		}
+	}
+
+	if depth > 0 {
+		return 0, errors.Errorf("%v unclosed \"(\"", depth)
+	}
+
+	if hasContent {
+		statements++
+	}
+
+	if statements == 0 {
+		return 0, errBlankSQL
+	}
+	return statements, nil
+}
+
+// blockCommentEnd returns a position of the end of the (possibly nested) block comment starting at the position
+func blockCommentEnd(sql string, start int) (int, error) {
+	depth := 0
+
+	for i := start; i < len(sql)-1; i++ {
+		switch sql[i : i+2] {
+		case "/*":
+			depth++
+			i++
+		case "*/":
+			depth--
+			i++
+			if depth == 0 {
+				return i, nil
+			}
+		}
+	}
+	return 0, errors.Errorf("unterminated block comment at position %v", start)
+}
+
+// quoteEnd returns a position of the closing quote for the quote at the position
+func quoteEnd(sql string, start int, quote byte, backslashEscapes bool) (int, error) {
+	for i := start + 1; i < len(sql); i++ {
+		switch {
+		case backslashEscapes && sql[i] == '\\':
+			i++
+		case sql[i] == quote && i+1 < len(sql) && sql[i+1] == quote:
+			i++
+		case sql[i] == quote:
+			return i, nil
+		}
+	}
+	return 0, errors.Errorf("at position %v", start)
+}
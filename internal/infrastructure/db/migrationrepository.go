@@ -3,12 +3,16 @@ package db
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"github.com/jmoiron/sqlx"
+	"io"
+	"net"
 	"sort"
+	"strings"
+	"time"
 
 	"github.com/pkg/errors"
-	// pq is the driver for the postgres dialect
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 
 	"github.com/Kalinin-Andrey/dbmigrator/internal/pkg/apperror"
 
@@ -19,25 +23,84 @@ import (
 // MigrationRepository is a repository for the migration entity
 type MigrationRepository struct {
 	repository
+	namespace	string
+	retryPolicy	migration.RetryPolicy
+	// session is the dedicated connection of a run, transactions are begun on the pool if it is nil
+	session		*session
+}
+
+// session is the dedicated connection of a run with the setup that is run on each new connection
+type session struct {
+	conn	*sqlx.Conn
+	setup	migration.SessionSetup
 }
 
 var _ migration.IRepository = (*MigrationRepository)(nil)
 
+// pqUndefinedTable is the code of postgres error for a not existing table
+const pqUndefinedTable = "42P01"
+
+// isUndefinedTable returns true if err is the error of a not existing table
+func isUndefinedTable(err error) bool {
+	pqErr, ok := err.(*pq.Error)
+	return ok && pqErr.Code == pqUndefinedTable
+}
+
+// pqLockNotAvailable is the code of postgres error for a lock that is not got within lock_timeout
+const pqLockNotAvailable = "55P03"
+
+// isLockTimeout returns true if err is or wraps the error of timeout of waiting for a lock
+func isLockTimeout(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == pqLockNotAvailable
+}
+
+// sqlState returns the SQLSTATE code of the error, a dropped connection is the connection failure
+func sqlState(err error) string {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return string(pqErr.Code)
+	}
+	var netErr net.Error
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.As(err, &netErr) {
+		return migration.SQLStateConnectionFailure
+	}
+	return ""
+}
+
+// usersError wraps the error of the user's SQL or func with the kind, errors of timeout of waiting for a lock are wrapped with apperror.ErrLockTimeout
+func usersError(kind error, format string, err error) error {
+	if isLockTimeout(err) {
+		kind = apperror.ErrLockTimeout
+	}
+	return errors.Wrapf(kind, format, err)
+}
+
 // NewMigrationRepository creates a new Repository
 func NewMigrationRepository(repository *repository) (*MigrationRepository, error) {
 	return &MigrationRepository{repository: *repository}, nil
 }
 
 // SetLogger is setter for logger
-func (r MigrationRepository) SetLogger(logger app.Logger) {
-	r.logger = logger
+func (r *MigrationRepository) SetLogger(logger app.Logger) {
+	r.logger = app.Slog(logger)
+}
+
+// SetRetryPolicy is setter for the policy of retries of transactions of migrations failed by transient errors
+func (r *MigrationRepository) SetRetryPolicy(policy migration.RetryPolicy) {
+	r.retryPolicy = policy
+}
+
+// SetNamespace is setter for the namespace of migrations
+func (r *MigrationRepository) SetNamespace(namespace string) {
+	r.namespace = namespace
 }
 
 // get reads entities with the specified ID from the database.
 func (r MigrationRepository) get(ctx context.Context, tx *sqlx.Tx, id uint) (*migration.Log, error) {
 	entity := &migration.Log{}
 
-	err := tx.GetContext(ctx, entity, "SELECT * FROM " + migration.TableName + " WHERE id = $1", id)
+	err := tx.GetContext(ctx, entity, "SELECT * FROM " + migration.TableName + " WHERE namespace = $1 AND id = $2", r.namespace, id)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, apperror.ErrNotFound
@@ -54,11 +117,14 @@ func (r MigrationRepository) Query(ctx context.Context, offset, limit uint) ([]m
 		limit = MaxLIstLimit
 	}
 
-	err := r.db.DB().SelectContext(ctx, &items, "SELECT * FROM " + migration.TableName + " ORDER BY id LIMIT $1 OFFSET $2", limit, offset)
+	err := r.db.DB().SelectContext(ctx, &items, "SELECT * FROM " + migration.TableName + " WHERE namespace = $1 ORDER BY id LIMIT $2 OFFSET $3", r.namespace, limit, offset)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, apperror.ErrNotFound
 		}
+		if isUndefinedTable(err) {
+			return nil, errors.Wrapf(apperror.ErrNoTable, "MigrationRepository.Query error: %v", err)
+		}
 		return nil, errors.Wrapf(apperror.ErrInternal, "MigrationRepository.Query error: %v", err)
 	}
 	return items, nil
@@ -77,10 +143,11 @@ func (r MigrationRepository) QueryTx(ctx context.Context, t migration.Transactio
 	if limit < 1 {
 		limit = MaxLIstLimit
 	}
-	params := []interface{}{limit, offset}
+	params := []interface{}{limit, offset, r.namespace}
+	where = " WHERE namespace = $3 "
 
 	if query != nil && query.Where != nil {
-		where = " WHERE status = $3 "
+		where += " AND status = $4 "
 		params = append(params, query.Where.Status)
 	}
 
@@ -95,11 +162,11 @@ func (r MigrationRepository) QueryTx(ctx context.Context, t migration.Transactio
 
 // Last retrieves a last record with the specified query condition and limit 1 from the database.
 func (r MigrationRepository) Last(ctx context.Context, query *migration.QueryCondition) (*migration.Log, error) {
-	var where string
-	var params []interface{}
+	where := " WHERE namespace = $1 "
+	params := []interface{}{r.namespace}
 
 	if query != nil && query.Where != nil {
-		where = " WHERE status = $1 "
+		where += " AND status = $2 "
 		params = append(params, query.Where.Status)
 	}
 	entity := &migration.Log{}
@@ -109,6 +176,10 @@ func (r MigrationRepository) Last(ctx context.Context, query *migration.QueryCon
 		if err == sql.ErrNoRows {
 			return nil, apperror.ErrNotFound
 		}
+		if isUndefinedTable(err) {
+			return nil, errors.Wrapf(apperror.ErrNoTable, "MigrationRepository.Last error: %v", err)
+		}
+		return nil, errors.Wrapf(apperror.ErrInternal, "MigrationRepository.Last error: %v", err)
 	}
 	return entity, nil
 }
@@ -122,10 +193,11 @@ func (r MigrationRepository) LastTx(ctx context.Context, t migration.Transaction
 		return nil, errors.New("can not assert param t migration.Transaction to *sqlx.Tx")
 	}
 
-	params := []interface{}{}
+	params := []interface{}{r.namespace}
+	where = " WHERE namespace = $1 "
 
 	if query != nil && query.Where != nil {
-		where = " WHERE status = $1 "
+		where += " AND status = $2 "
 		params = append(params, query.Where.Status)
 	}
 	entity := &migration.Log{}
@@ -139,6 +211,54 @@ func (r MigrationRepository) LastTx(ctx context.Context, t migration.Transaction
 	return entity, nil
 }
 
+// IsAppliedTx returns true if the migration with the ID of the namespace is applied
+func (r MigrationRepository) IsAppliedTx(ctx context.Context, t migration.Transaction, namespace string, id uint) (bool, error) {
+	var applied bool
+
+	tx, ok := t.(*sqlx.Tx)
+	if !ok {
+		return false, errors.New("can not assert param t migration.Transaction to *sqlx.Tx")
+	}
+
+	err := tx.GetContext(ctx, &applied, "SELECT EXISTS (SELECT 1 FROM " + migration.TableName + " WHERE namespace = $1 AND id = $2 AND status = $3)", namespace, id, migration.StatusApplied)
+	if err != nil {
+		return false, errors.Wrapf(err, "MigrationRepository.IsAppliedTx error")
+	}
+	return applied, nil
+}
+
+// QueryRepeatable retrieves logs of repeatable migrations from the database.
+func (r MigrationRepository) QueryRepeatable(ctx context.Context) ([]migration.RepeatableLog, error) {
+	var items []migration.RepeatableLog
+
+	err := r.db.DB().SelectContext(ctx, &items, "SELECT * FROM " + migration.TableNameRepeatable + " WHERE namespace = $1 ORDER BY name", r.namespace)
+	if err != nil {
+		if isUndefinedTable(err) {
+			return nil, errors.Wrapf(apperror.ErrNoTable, "MigrationRepository.QueryRepeatable error: %v", err)
+		}
+		return nil, errors.Wrapf(apperror.ErrInternal, "MigrationRepository.QueryRepeatable error: %v", err)
+	}
+	return items, nil
+}
+
+// SaveRepeatableTx creates or updates a log of a repeatable migration in the database.
+func (r MigrationRepository) SaveRepeatableTx(ctx context.Context, t migration.Transaction, l *migration.RepeatableLog) error {
+	tx, ok := t.(*sqlx.Tx)
+	if !ok {
+		return errors.New("can not assert param t migration.Transaction to *sqlx.Tx")
+	}
+
+	_, err := tx.ExecContext(ctx, `
+			INSERT INTO ` + migration.TableNameRepeatable + ` (namespace, "name", checksum, "time") 
+			VALUES ($1, $2, $3, Now()) 
+			ON CONFLICT (namespace, "name") DO UPDATE SET checksum = EXCLUDED.checksum, "time" = EXCLUDED."time"
+		`, r.namespace, l.Name, l.Checksum)
+	if err != nil {
+		return errors.Wrapf(err, "MigrationRepository: error saving log of repeatable migration %v", l)
+	}
+	return nil
+}
+
 // BatchCreateTx saves a batch of a new entities in the database.
 func (r MigrationRepository) BatchCreateTx(ctx context.Context, t migration.Transaction, list migration.LogsList) error {
 	tx, ok := t.(*sqlx.Tx)
@@ -184,14 +304,34 @@ func (r MigrationRepository) BatchUpdateTx(ctx context.Context, t migration.Tran
 	return nil
 }
 
+// BatchDeleteTx deletes records of a batch entities from the database.
+func (r MigrationRepository) BatchDeleteTx(ctx context.Context, t migration.Transaction, list migration.LogsList) error {
+	tx, ok := t.(*sqlx.Tx)
+	if !ok {
+		return errors.New("can not assert param t migration.Transaction to *sqlx.Tx")
+	}
+
+	ids := list.IDs()
+	sort.Ints(ids)
+
+	for _, i := range ids {
+		id := uint(i)
+		err := r.delete(ctx, tx, id)
+		if err != nil {
+			return errors.Wrapf(apperror.ErrInternal, "error while deleting log of migration #%v", id)
+		}
+	}
+	return nil
+}
+
 // create saves a new entity in the database.
 func (r MigrationRepository) create(ctx context.Context, tx *sqlx.Tx, entity *migration.Log) error {
 	var lastInsertID uint
 
 	err := tx.QueryRowContext(ctx, `
-			INSERT INTO ` + migration.TableName + ` (id, status, "name", "time") 
-			VALUES ($1, $2, $3, Now()) RETURNING id
-		`, entity.ID, entity.Status, entity.Name).Scan(&lastInsertID)
+			INSERT INTO ` + migration.TableName + ` (namespace, id, status, "name", "time") 
+			VALUES ($1, $2, $3, $4, Now()) RETURNING id
+		`, r.namespace, entity.ID, entity.Status, entity.Name).Scan(&lastInsertID)
 	if err != nil {
 		return errors.Wrapf(err, "MigrationRepository: error inserting entity %v", entity)
 	}
@@ -211,8 +351,8 @@ func (r MigrationRepository) update(ctx context.Context, tx *sqlx.Tx, entity *mi
 	_, err := tx.ExecContext(ctx, `
 			UPDATE ` + migration.TableName + ` 
 			SET status = $1, "name" = $2, "time" = Now() 
-			WHERE id = $3
-		`, entity.Status, entity.Name, entity.ID)
+			WHERE namespace = $3 AND id = $4
+		`, entity.Status, entity.Name, r.namespace, entity.ID)
 	if err != nil {
 		return errors.Wrapf(err, "MigrationRepository: error updating entity %v", entity)
 	}
@@ -227,53 +367,197 @@ func (r MigrationRepository) update(ctx context.Context, tx *sqlx.Tx, entity *mi
 }
 
 // delete deletes a record with the specified ID from the database.
-/*func (r MigrationRepository) delete(ctx context.Context, tx *sqlx.Tx, id uint) error {
-	_, err := tx.ExecContext(ctx, "DELETE FROM migration WHERE id = $1", id)
+func (r MigrationRepository) delete(ctx context.Context, tx *sqlx.Tx, id uint) error {
+	_, err := tx.ExecContext(ctx, "DELETE FROM " + migration.TableName + " WHERE namespace = $1 AND id = $2", r.namespace, id)
 	if err != nil {
 		return errors.Wrapf(err, "MigrationRepository: error deleting record id = %v", id)
 	}
 	return nil
-}*/
+}
 
 // BeginTx begins a transaction
 func (r MigrationRepository) BeginTx(ctx context.Context) (migration.Transaction, error) {
+	return r.beginTx(ctx)
+}
+
+// beginTx begins a transaction on the connection of the session or on the pool
+func (r MigrationRepository) beginTx(ctx context.Context) (*sqlx.Tx, error) {
+	if r.session != nil {
+		return r.session.conn.BeginTxx(ctx, nil)
+	}
 	return r.db.DB().BeginTxx(ctx, nil)
 }
 
-// ExecSQL executes a SQL code
-func (r MigrationRepository) ExecSQL(ctx context.Context, sql string) error {
-	tx, err := r.db.DB().BeginTxx(ctx, nil)
+// Session returns a copy of the repository that begins all transactions on one dedicated connection, the setup is run on it
+func (r MigrationRepository) Session(ctx context.Context, setup migration.SessionSetup) (migration.IRepository, error) {
+	r.session = &session{setup: setup}
+
+	if err := r.connect(ctx); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// connect gets a connection of the session from the pool and runs the setup of the session on it
+func (r MigrationRepository) connect(ctx context.Context) error {
+	conn, err := r.db.DB().Connx(ctx)
+	if err != nil {
+		return errors.Wrapf(err, "MigrationRepository.Session: get a connection error")
+	}
+
+	tx, err := conn.BeginTxx(ctx, nil)
 	if err != nil {
-		return errors.Wrapf(err, "MigrationRepository.ExecSQL: transaction begin error")
+		conn.Close()
+		return errors.Wrapf(err, "MigrationRepository.Session: transaction begin error")
+	}
+
+	if err = r.session.setup(ctx, tx); err != nil {
+		// settings made by the setup are rolled back with the transaction
+		if er := tx.Rollback(); er != nil {
+			r.logger.Error("MigrationRepository.Session: transaction rollback error", "error", er)
+		}
+		conn.Close()
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		discard(conn)
+		return errors.Wrapf(err, "MigrationRepository.Session: transaction commit error")
+	}
+	r.session.conn = conn
+	return nil
+}
+
+// reconnect replaces the dropped connection of the session with a new one and runs the setup of the session on it
+func (r MigrationRepository) reconnect(ctx context.Context) error {
+	discard(r.session.conn)
+	return r.connect(ctx)
+}
+
+// Close resets settings of the session and releases its connection to the pool
+func (r MigrationRepository) Close() error {
+	if r.session == nil {
+		return nil
+	}
+
+	if _, err := r.session.conn.ExecContext(context.Background(), "RESET ALL"); err != nil {
+		discard(r.session.conn)
+		return errors.Wrapf(err, "MigrationRepository.Close: reset of the session error")
+	}
+	return r.session.conn.Close()
+}
+
+// discard closes the driver connection of conn instead of returning it to the pool, e.g. because it is broken or has settings of a session
+func discard(conn *sqlx.Conn) {
+	conn.Raw(func(driverConn interface{}) error {
+		return driver.ErrBadConn
+	})
+	conn.Close()
+}
+
+// logExec writes the result of execution of SQL or a func of a migration at the debug level
+func (r MigrationRepository) logExec(action string, start time.Time, err error) {
+	attrs := []interface{}{"action", action, "namespace", r.namespace, "duration", time.Since(start)}
+	if err != nil {
+		attrs = append(attrs, "error", err)
+	}
+	r.logger.Debug("migration action executed", attrs...)
+}
+
+// retry executes the attempt in a loop while it fails by a transient error, the attempt returns true if it is retryable.
+// The number of attempts and delays between them are set by the retry policy, each retry is logged at the warning level.
+func (r MigrationRepository) retry(ctx context.Context, action string, attempt func() (retryable bool, err error)) error {
+	for n := 1; ; n++ {
+		retryable, err := attempt()
+		if err == nil || !retryable || n >= r.retryPolicy.MaxAttempts {
+			return err
+		}
+		delay := r.retryPolicy.Delay(n)
+		r.logger.Warn("migration transaction retried", "action", action, "namespace", r.namespace, "attempt", n, "delay", delay, "error", err)
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+
+		// the dropped connection of the session is replaced, settings of the session are made again on the new one
+		if r.session != nil && strings.HasPrefix(sqlState(err), migration.SQLStateClassConnection) {
+			if er := r.reconnect(ctx); er != nil {
+				return errors.Wrapf(er, "MigrationRepository: reconnect error after %v", err)
+			}
+		}
+	}
+}
+
+// transient returns true if the error is retryable by the retry policy
+func (r MigrationRepository) transient(err error) bool {
+	return r.retryPolicy.Retryable(sqlState(err))
+}
+
+// transientCommit returns true if the error of commit is retryable: the transaction may be committed before a dropped connection, so it is retried only for idempotent migrations
+func (r MigrationRepository) transientCommit(ctx context.Context, err error) bool {
+	code := sqlState(err)
+	if strings.HasPrefix(code, migration.SQLStateClassConnection) && !migration.IsIdempotent(ctx) {
+		return false
+	}
+	return r.retryPolicy.Retryable(code)
+}
+
+// ExecSQL executes a SQL code in its own transaction, the transaction is retried on transient errors by the retry policy
+func (r MigrationRepository) ExecSQL(ctx context.Context, sql string) (returnErr error) {
+	defer func(start time.Time) { r.logExec("sql", start, returnErr) }(time.Now())
+
+	return r.retry(ctx, "sql", func() (bool, error) {
+		return r.execSQL(ctx, sql)
+	})
+}
+
+// execSQL executes a SQL code in a transaction once
+func (r MigrationRepository) execSQL(ctx context.Context, sql string) (retryable bool, returnErr error) {
+	tx, err := r.beginTx(ctx)
+	if err != nil {
+		return r.transient(err), errors.Wrapf(err, "MigrationRepository.ExecSQL: transaction begin error")
 	}
 
 	_, err = tx.ExecContext(ctx, sql)
 	if err != nil {
-		er := errors.Wrapf(apperror.ErrUsersSQL, "MigrationRepository.ExecSQL error: %v", err)
+		retryable = r.transient(err)
+		er := usersError(apperror.ErrUsersSQL, "MigrationRepository.ExecSQL error: %v", err)
 		err = tx.Rollback()
 		if err != nil {
-			r.logger.Print(er)
-			return errors.Wrapf(err, "MigrationRepository.ExecSQL tx.Rollback() error")
+			r.logger.Error("MigrationRepository.ExecSQL error", "error", er)
+			return retryable, errors.Wrapf(err, "MigrationRepository.ExecSQL tx.Rollback() error")
 		}
-		return er
+		return retryable, er
 	}
 	err = tx.Commit()
 	if err != nil {
-		return errors.Wrapf(err, "MigrationRepository.ExecSQL tx.Commit() error")
+		return r.transientCommit(ctx, err), errors.Wrapf(err, "MigrationRepository.ExecSQL tx.Commit() error")
 	}
 
-	return nil
+	return false, nil
 }
 
-// ExecFunc executes a function
+// ExecFunc executes a function in its own transaction, the transaction is retried on transient errors by the retry policy
 func (r MigrationRepository) ExecFunc(ctx context.Context, f migration.Func) (returnErr error) {
-	tx, err := r.db.DB().BeginTxx(ctx, nil)
+	defer func(start time.Time) { r.logExec("func", start, returnErr) }(time.Now())
+
+	return r.retry(ctx, "func", func() (bool, error) {
+		return r.execFunc(ctx, f)
+	})
+}
+
+// execFunc executes a function in a transaction once
+func (r MigrationRepository) execFunc(ctx context.Context, f migration.Func) (retryable bool, returnErr error) {
+	tx, err := r.beginTx(ctx)
 	if err != nil {
-		return errors.Wrapf(err, "MigrationRepository.ExecFunc: transaction begin error")
+		return r.transient(err), errors.Wrapf(err, "MigrationRepository.ExecFunc: transaction begin error")
 	}
 
 	defer func() {
 		if err := recover(); err != nil {
+			retryable = false
 			returnErr = errors.Wrapf(apperror.ErrUsersFunc, "MigrationRepository.ExecFunc error: %v", err)
 			err = tx.Rollback()
 			if err != nil {
@@ -284,23 +568,26 @@ func (r MigrationRepository) ExecFunc(ctx context.Context, f migration.Func) (re
 
 	err = f(tx)
 	if err != nil {
-		er := errors.Wrapf(apperror.ErrUsersFunc, "MigrationRepository.ExecFunc error: %v", err)
+		retryable = r.transient(err)
+		er := usersError(apperror.ErrUsersFunc, "MigrationRepository.ExecFunc error: %v", err)
 		err = tx.Rollback()
 		if err != nil {
-			return errors.Wrapf(err, "MigrationRepository.ExecFunc tx.Rollback() error")
+			return retryable, errors.Wrapf(err, "MigrationRepository.ExecFunc tx.Rollback() error")
 		}
-		return er
+		return retryable, er
 	}
 	err = tx.Commit()
 	if err != nil {
-		return errors.Wrapf(err, "MigrationRepository.ExecFunc tx.Commit() error")
+		return r.transientCommit(ctx, err), errors.Wrapf(err, "MigrationRepository.ExecFunc tx.Commit() error")
 	}
 
-	return nil
+	return false, nil
 }
 
 // ExecSQLTx executes a SQL code
-func (r MigrationRepository) ExecSQLTx(ctx context.Context, t migration.Transaction, sql string) error {
+func (r MigrationRepository) ExecSQLTx(ctx context.Context, t migration.Transaction, sql string) (returnErr error) {
+	defer func(start time.Time) { r.logExec("sql", start, returnErr) }(time.Now())
+
 	tx, ok := t.(*sqlx.Tx)
 	if !ok {
 		return errors.New("can not assert param t migration.Transaction to *sqlx.Tx")
@@ -308,7 +595,7 @@ func (r MigrationRepository) ExecSQLTx(ctx context.Context, t migration.Transact
 
 	_, err := tx.ExecContext(ctx, sql)
 	if err != nil {
-		return errors.Wrapf(apperror.ErrUsersSQL, "MigrationRepository.ExecSQL error: %v", err)
+		return usersError(apperror.ErrUsersSQL, "MigrationRepository.ExecSQL error: %v", err)
 	}
 
 	return nil
@@ -316,6 +603,8 @@ func (r MigrationRepository) ExecSQLTx(ctx context.Context, t migration.Transact
 
 // ExecFuncTx executes a function
 func (r MigrationRepository) ExecFuncTx(ctx context.Context, t migration.Transaction, f migration.Func) (returnErr error) {
+	defer func(start time.Time) { r.logExec("func", start, returnErr) }(time.Now())
+
 	tx, ok := t.(*sqlx.Tx)
 	if !ok {
 		return errors.New("can not assert param t migration.Transaction to *sqlx.Tx")
@@ -329,7 +618,7 @@ func (r MigrationRepository) ExecFuncTx(ctx context.Context, t migration.Transac
 
 	err := f(tx)
 	if err != nil {
-		return errors.Wrapf(apperror.ErrUsersFunc, "MigrationRepository.ExecFunc error: %v", err)
+		return usersError(apperror.ErrUsersFunc, "MigrationRepository.ExecFunc error: %v", err)
 	}
 
 	return nil
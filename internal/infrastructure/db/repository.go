@@ -3,6 +3,7 @@ package db
 import (
 	"context"
 	"log"
+	"log/slog"
 	"os"
 
 	"github.com/pkg/errors"
@@ -22,7 +23,7 @@ type IRepository interface {
 // repository persists albums in database
 type repository struct {
 	db                dbx.DBx
-	logger            app.Logger
+	logger            *slog.Logger
 	//defaultConditions map[string]interface{}
 }
 
@@ -36,7 +37,7 @@ func GetRepository(dbase dbx.DBx, logger app.Logger, entity string) (repo IRepos
 	}
 	r := &repository{
 		db:     dbase,
-		logger: logger,
+		logger: app.Slog(logger),
 	}
 
 	switch entity {
@@ -0,0 +1,153 @@
+package gomigration
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/Kalinin-Andrey/dbmigrator/internal/domain/migration"
+)
+
+// EventLog is the type of a message with a log of a migration, it is not an event of execution of a migration
+const EventLog = "log"
+
+// EventOutput is the type of a message with a line of output of a command, e.g. of the graph
+const EventOutput = "output"
+
+// EventPending is the type of a message with the number of pending migrations after a run of migrations, it is not an event of execution of a migration
+const EventPending = "pending"
+
+// Message is a line of the JSON-lines protocol of events between the parent and the child process
+type Message struct {
+	Event		string			`json:"event"`
+	ID			uint			`json:"id"`
+	Name		string			`json:"name"`
+	Direction	string			`json:"direction,omitempty"`
+	Statements	int				`json:"statements,omitempty"`
+	Duration	time.Duration	`json:"duration,omitempty"`
+	Error		string			`json:"error,omitempty"`
+	Status		uint			`json:"status,omitempty"`
+	Time		*time.Time		`json:"time,omitempty"`
+	Text		string			`json:"text,omitempty"`
+	Pending		int				`json:"pending,omitempty"`
+}
+
+// NewMessage creates a message from the event
+func NewMessage(e migration.Event) Message {
+	m := Message{
+		Event:		e.Type,
+		ID:			e.ID,
+		Name:		e.Name,
+		Direction:	e.Direction,
+		Statements:	e.Statements,
+		Duration:	e.Duration,
+	}
+	if e.Err != nil {
+		m.Error = e.Err.Error()
+	}
+	return m
+}
+
+// NewLogMessage creates a message from the log of a migration
+func NewLogMessage(l migration.Log) Message {
+	m := Message{
+		Event:		EventLog,
+		ID:			l.ID,
+		Name:		l.Name,
+		Status:		l.Status,
+	}
+	if !l.Time.IsZero() {
+		m.Time = &l.Time
+	}
+	return m
+}
+
+// CoreLog converts to the core log of a migration
+func (m Message) CoreLog() migration.Log {
+	l := migration.Log{
+		ID:			m.ID,
+		Name:		m.Name,
+		Status:		m.Status,
+	}
+	if m.Time != nil {
+		l.Time = *m.Time
+	}
+	return l
+}
+
+// CoreEvent converts to the core event
+func (m Message) CoreEvent() migration.Event {
+	e := migration.Event{
+		Type:		m.Event,
+		ID:			m.ID,
+		Name:		m.Name,
+		Direction:	m.Direction,
+		Statements:	m.Statements,
+		Duration:	m.Duration,
+	}
+	if m.Error != "" {
+		e.Err = errors.New(m.Error)
+	}
+	return e
+}
+
+// ParseMessage parses a line of output of the child process, ok is false if the line is not a message
+func ParseMessage(line string) (m Message, ok bool) {
+	if !strings.HasPrefix(line, `{"event":`) {
+		return m, false
+	}
+
+	if err := json.Unmarshal([]byte(line), &m); err != nil {
+		return m, false
+	}
+	return m, m.Event != ""
+}
+
+// EventWriter writes events as lines of the JSON-lines protocol
+type EventWriter struct {
+	mu		sync.Mutex
+	enc		*json.Encoder
+}
+
+var _ migration.Listener = (*EventWriter)(nil)
+
+// NewEventWriter creates a new EventWriter
+func NewEventWriter(w io.Writer) *EventWriter {
+	return &EventWriter{enc: json.NewEncoder(w)}
+}
+
+// OnEvent writes the event
+func (w *EventWriter) OnEvent(e migration.Event) {
+	w.write(NewMessage(e))
+}
+
+// WriteLogs writes logs of migrations
+func (w *EventWriter) WriteLogs(list []migration.Log) {
+	for _, l := range list {
+		w.write(NewLogMessage(l))
+	}
+}
+
+// WriteOutput writes lines of output of a command
+func (w *EventWriter) WriteOutput(text string) {
+	for _, line := range strings.Split(strings.TrimSuffix(text, "\n"), "\n") {
+		w.write(Message{Event: EventOutput, Text: line})
+	}
+}
+
+// WritePending writes the number of pending migrations
+func (w *EventWriter) WritePending(pending int) {
+	w.write(Message{Event: EventPending, Pending: pending})
+}
+
+// write the message
+func (w *EventWriter) write(m Message) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	// the error is ignored to not break execution of migrations because of output
+	_ = w.enc.Encode(m)
+}
@@ -1,31 +1,133 @@
 package gomigration
 
 import (
+	"bufio"
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/Kalinin-Andrey/dbmigrator/internal/app"
+	"github.com/Kalinin-Andrey/dbmigrator/internal/pkg/apperror"
+	"github.com/Kalinin-Andrey/dbmigrator/internal/pkg/dbx"
 )
 
+// fileNameRegexp matches a file name of a migration and captures its ID
+var fileNameRegexp = regexp.MustCompile(`^(\d+)_`)
+
 // Args for execution of go migrations
 type Args struct {
-	DSN		string
-	Action	string
+	DSN				string
+	Action			string
+	IgnoreMissing	bool
+	OutOfOrder		string
+	DisallowGaps	bool
+	ReadOnly		bool
+	ID				uint
+	Namespace		string
+	// Dirs are additional directories of SQL migrations, they must be absolute because the child process is executed in Dir
+	Dirs			[]string
+	ConnectTimeout	time.Duration
+	RetryInterval	time.Duration
+	MaxAttempts		int
+	RetryAttempts	int
+	RetryBackoff	time.Duration
+	RetryClasses	[]string
 }
 
+// EnvDSN is the name of the environment variable with DSN for the child process, DSN is not passed in arguments to not be visible in the list of processes
+const EnvDSN = "DBMIGRATOR_DSN"
+
+// ExitCodeNoTable is the exit code of the child process when the history table does not exist
+const ExitCodeNoTable = 3
+
+// ExitCodeMigrationFailed is the exit code of the process when a migration is failed, the child process exits with it when SQL of a migration is failed
+const ExitCodeMigrationFailed = 4
+
+// ExitCodeDBUnreachable is the exit code of the process when connection to DB is failed
+const ExitCodeDBUnreachable = 5
+
+// ExitCodeLockTimeout is the exit code of the process when a migration is failed by timeout of waiting for a lock
+const ExitCodeLockTimeout = 6
+
+// ExitCodeNotFound is the exit code of the child process when there are no migrations for the action, e.g. nothing to apply
+const ExitCodeNotFound = 7
+
+// ExitCodeFuncFailed is the exit code of the child process when a func of a migration is failed
+const ExitCodeFuncFailed = 8
+
 // Strings returns representation in slice of strings
 func (a Args) Strings() []string {
-	return []string{fmt.Sprintf("--action=%s", a.Action), fmt.Sprintf("--dsn=%q", a.DSN)}
+	args := []string{fmt.Sprintf("--action=%s", a.Action)}
+	if a.IgnoreMissing {
+		args = append(args, "--ignore-missing")
+	}
+	if a.OutOfOrder != "" {
+		args = append(args, fmt.Sprintf("--out-of-order=%s", a.OutOfOrder))
+	}
+	if a.DisallowGaps {
+		args = append(args, "--disallow-gaps")
+	}
+	if a.ReadOnly {
+		args = append(args, "--read-only")
+	}
+	if a.ID != 0 {
+		args = append(args, fmt.Sprintf("--id=%d", a.ID))
+	}
+	if a.Namespace != "" {
+		args = append(args, fmt.Sprintf("--namespace=%s", a.Namespace))
+	}
+	if len(a.Dirs) > 0 {
+		args = append(args, fmt.Sprintf("--dirs=%s", strings.Join(a.Dirs, string(os.PathListSeparator))))
+	}
+	if a.ConnectTimeout != 0 {
+		args = append(args, fmt.Sprintf("--connect-timeout=%s", a.ConnectTimeout))
+	}
+	if a.RetryInterval != 0 {
+		args = append(args, fmt.Sprintf("--retry-interval=%s", a.RetryInterval))
+	}
+	if a.MaxAttempts != 0 {
+		args = append(args, fmt.Sprintf("--max-attempts=%d", a.MaxAttempts))
+	}
+	if a.RetryAttempts != 0 {
+		args = append(args, fmt.Sprintf("--retry-max-attempts=%d", a.RetryAttempts))
+	}
+	if a.RetryBackoff != 0 {
+		args = append(args, fmt.Sprintf("--retry-backoff=%s", a.RetryBackoff))
+	}
+	if len(a.RetryClasses) > 0 {
+		args = append(args, fmt.Sprintf("--retry-classes=%s", strings.Join(a.RetryClasses, ",")))
+	}
+	return args
+}
+
+// Env returns environment variables for the child process
+func (a Args) Env() []string {
+	return []string{EnvDSN + "=" + a.DSN}
 }
 
 // Dir of migration for execution
 type Dir struct {
 	Path			string
+	// CacheDir is a directory for compiled binaries, the user's cache directory is used by default
+	CacheDir		string
 }
 
+// binaryPrefix is the prefix of a name of the compiled binary
+const binaryPrefix = "migrations-"
+
 // Validate Dir
 func (d Dir) Validate() error {
 	i, err := os.Stat(d.Path)
@@ -35,33 +137,331 @@ func (d Dir) Validate() error {
 	}
 
 	if !i.IsDir() {
-		return errors.Wrapf(err, "It is not a directory: %q", d.Path)
+		return errors.Errorf("It is not a directory: %q", d.Path)
 	}
 
 	return nil
 }
 
-// Run Dir
-func (d Dir) Run(a Args) (output string, err error) {
-	var bufOut bytes.Buffer
+// IDs returns IDs of migrations files in Dir
+func (d Dir) IDs() ([]int, error) {
+	files, err := ioutil.ReadDir(d.Path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Can not read migration dir %q", d.Path)
+	}
+	ids := make([]int, 0, len(files))
+
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		m := fileNameRegexp.FindStringSubmatch(f.Name())
+		if m == nil {
+			continue
+		}
+		id, err := strconv.ParseUint(m[1], 10, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid ID of migration file %q", f.Name())
+		}
+		ids = append(ids, int(id))
+	}
+	return ids, nil
+}
+
+// Hash returns a hash of the sources of the binary of Dir: go files of Dir and its subpackages, go.mod and go.sum of Dir or of the module containing Dir,
+// the version of the Go toolchain and the target platform. Versions of dependencies, including dbmigrator, are covered by go.mod and go.sum.
+func (d Dir) Hash() (string, error) {
+	names, err := d.sources()
+	if err != nil {
+		return "", err
+	}
+	toolchain, err := d.toolchain()
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	h.Write(toolchain)
+
+	for _, n := range names {
+		content, err := ioutil.ReadFile(n)
+		if err != nil {
+			return "", errors.Wrapf(err, "Can not read migration file %q", n)
+		}
+		rel, err := filepath.Rel(d.Path, n)
+		if err != nil {
+			rel = n
+		}
+		fmt.Fprintf(h, "%s\n%d\n", filepath.ToSlash(rel), len(content))
+		h.Write(content)
+	}
+	return hex.EncodeToString(h.Sum(nil))[:32], nil
+}
+
+// toolchain returns the version of the Go toolchain and the target platform reported by go env in Dir,
+// so the toolchain selected by go.mod and GOOS, GOARCH of the environment are taken into account as by the build
+func (d Dir) toolchain() ([]byte, error) {
+	var bufErr bytes.Buffer
+
+	cmd := exec.Command("go", "env", "GOVERSION", "GOOS", "GOARCH")
+	cmd.Dir = d.Path
+	cmd.Stderr = &bufErr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, errors.Wrapf(err, "gomigration.Dir.Hash() go env error, migration dir: %q; Stderr: %q", d.Path, bufErr.String())
+	}
+	return out, nil
+}
+
+// moduleFiles are files of a module that define versions of dependencies
+var moduleFiles = []string{"go.mod", "go.sum"}
+
+// sources returns sorted paths of go files of Dir and its subdirectories and of module files of Dir or of the nearest parent module,
+// hidden directories and testdata are skipped as the go tool does
+func (d Dir) sources() ([]string, error) {
+	var names []string
+
+	err := filepath.Walk(d.Path, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		name := info.Name()
+
+		if info.IsDir() {
+			if path != d.Path && (strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "testdata") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if filepath.Ext(name) == ".go" || (filepath.Dir(path) != d.Path && isModuleFile(name)) {
+			names = append(names, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "Can not read migration dir %q", d.Path)
+	}
+
+	moduleDir, err := d.moduleDir()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range moduleFiles {
+		path := filepath.Join(moduleDir, f)
+		if _, err := os.Stat(path); err == nil {
+			names = append(names, path)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// isModuleFile returns true if the file name is a name of a module file
+func isModuleFile(name string) bool {
+	for _, f := range moduleFiles {
+		if name == f {
+			return true
+		}
+	}
+	return false
+}
+
+// moduleDir returns Dir if it has go.mod or the nearest parent directory with go.mod, Dir is returned if there is no go.mod
+func (d Dir) moduleDir() (string, error) {
+	dir, err := filepath.Abs(d.Path)
+	if err != nil {
+		return "", errors.Wrapf(err, "Invalid migration dir %q", d.Path)
+	}
+
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			return dir, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return d.Path, nil
+		}
+		dir = parent
+	}
+}
+
+// Binary returns a path of the compiled binary for the current content of Dir
+func (d Dir) Binary() (string, error) {
+	cacheDir := d.CacheDir
+
+	if cacheDir == "" {
+		userCacheDir, err := os.UserCacheDir()
+		if err != nil {
+			return "", errors.Wrapf(err, "Can not get the user's cache dir")
+		}
+		cacheDir = filepath.Join(userCacheDir, "dbmigrator")
+	}
+
+	// the binary is built and executed in Dir, so the path must not be relative
+	cacheDir, err := filepath.Abs(cacheDir)
+	if err != nil {
+		return "", errors.Wrapf(err, "Invalid cache dir %q", cacheDir)
+	}
+
+	hash, err := d.Hash()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cacheDir, binaryPrefix + hash), nil
+}
+
+// Build compiles Dir into the cached binary if it does not exist or force is set, and returns a path of the binary
+func (d Dir) Build(force bool) (string, error) {
 	var bufErr bytes.Buffer
-	var dir	string
 
-	if !filepath.IsAbs(d.Path) {
-		dir = "./" + strings.TrimPrefix(d.Path, "./")
+	binary, err := d.Binary()
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := os.Stat(binary); err == nil && !force {
+		return binary, nil
 	}
-	args := a.Strings()
 
-	cmd := exec.Command("go", "run", dir, args[0], args[1])
-	cmd.Stdout = &bufOut
+	if err = os.MkdirAll(filepath.Dir(binary), 0755); err != nil {
+		return "", errors.Wrapf(err, "Can not create the cache dir %q", filepath.Dir(binary))
+	}
+
+	// the binary is built under a unique temporary name, so a broken build is never taken from the cache and concurrent builds do not overwrite each other
+	f, err := os.CreateTemp(filepath.Dir(binary), "." + filepath.Base(binary) + ".*.tmp")
+	if err != nil {
+		return "", errors.Wrapf(err, "Can not create a temporary binary in the cache dir %q", filepath.Dir(binary))
+	}
+	tmp := f.Name()
+	if err = f.Close(); err != nil {
+		os.Remove(tmp)
+		return "", errors.Wrapf(err, "Can not close the temporary binary %q", tmp)
+	}
+	cmd := exec.Command("go", "build", "-o", tmp, ".")
+	cmd.Dir = d.Path
 	cmd.Stderr = &bufErr
 
 	if err = cmd.Run(); err != nil {
-		err = errors.Wrapf(err, "gomigration.Dir.Run() execution error, migration dir: %q; Stderr: %q", d.Path, bufErr.String())
-	} else if bufErr.String() != "" {
-		err = errors.Errorf("Stderr: %q", bufErr.String())
+		os.Remove(tmp)
+		return "", errors.Wrapf(err, "gomigration.Dir.Build() compilation error, migration dir: %q; Stderr: %q", d.Path, bufErr.String())
 	}
 
-	return bufOut.String(), err
+	if err = os.Rename(tmp, binary); err != nil {
+		os.Remove(tmp)
+		return "", errors.Wrapf(err, "Can not move the binary to %q", binary)
+	}
+	return binary, nil
 }
 
+// Run Dir, output of the child process is streamed line by line to the logger, messages of the protocol are passed to the handler, the success is defined by the exit code only
+func (d Dir) Run(a Args, logger app.Logger, handler func(m Message)) (err error) {
+	binary, err := d.Build(false)
+	if err != nil {
+		return err
+	}
+
+	// the migrations are executed in Dir to find SQL migrations files there
+	cmd := exec.Command(binary, a.Strings()...)
+	cmd.Dir = d.Path
+	cmd.Env = append(os.Environ(), a.Env()...)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return errors.Wrapf(err, "gomigration.Dir.Run() stdout pipe error")
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return errors.Wrapf(err, "gomigration.Dir.Run() stderr pipe error")
+	}
+
+	if err = cmd.Start(); err != nil {
+		return errors.Wrapf(err, "gomigration.Dir.Run() start error, migration dir: %q", d.Path)
+	}
+	tail := &lines{max: stderrTailSize}
+	wg := sync.WaitGroup{}
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		stream(stdout, a.DSN, logger, handler, nil)
+	}()
+	go func() {
+		defer wg.Done()
+		stream(stderr, a.DSN, logger, nil, tail)
+	}()
+	// all output must be read before Wait closes the pipes
+	wg.Wait()
+
+	if err = cmd.Wait(); err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			switch exitErr.ExitCode() {
+			case ExitCodeNoTable:
+				return errors.Wrapf(apperror.ErrNoTable, "gomigration.Dir.Run() execution error, migration dir: %q", d.Path)
+			case ExitCodeDBUnreachable:
+				return errors.Wrapf(apperror.ErrDBUnreachable, "gomigration.Dir.Run() execution error, migration dir: %q; Stderr: %q", d.Path, tail.String())
+			case ExitCodeLockTimeout:
+				return errors.Wrapf(apperror.ErrLockTimeout, "gomigration.Dir.Run() execution error, migration dir: %q; Stderr: %q", d.Path, tail.String())
+			case ExitCodeNotFound:
+				return errors.Wrapf(apperror.ErrNotFound, "gomigration.Dir.Run() execution error, migration dir: %q; Stderr: %q", d.Path, tail.String())
+			case ExitCodeMigrationFailed:
+				return errors.Wrapf(apperror.ErrUsersSQL, "gomigration.Dir.Run() execution error, migration dir: %q; Stderr: %q", d.Path, tail.String())
+			case ExitCodeFuncFailed:
+				return errors.Wrapf(apperror.ErrUsersFunc, "gomigration.Dir.Run() execution error, migration dir: %q; Stderr: %q", d.Path, tail.String())
+			}
+		}
+		return errors.Wrapf(err, "gomigration.Dir.Run() execution error, migration dir: %q; Stderr: %q", d.Path, tail.String())
+	}
+	return nil
+}
+
+// stderrTailSize is the number of last lines of stderr added to an error
+const stderrTailSize = 10
+
+// maxLineSize is the max size of a line of output of the child process
+const maxLineSize = 1024 * 1024
+
+// stream reads r line by line and prints lines without DSN to the logger, lines are saved to tail if it is not nil.
+// Messages of the protocol are passed to the handler if it is not nil.
+func stream(r io.Reader, dsn string, logger app.Logger, handler func(m Message), tail *lines) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), maxLineSize)
+
+	for scanner.Scan() {
+		line := dbx.ScrubDSN(scanner.Text(), dsn)
+		if handler != nil {
+			if m, ok := ParseMessage(line); ok {
+				handler(m)
+				continue
+			}
+		}
+		logger.Print(line)
+		if tail != nil {
+			tail.add(line)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		logger.Print("gomigration.Dir.Run() read output error: ", err)
+	}
+}
+
+// lines keeps max last lines
+type lines struct {
+	max		int
+	list	[]string
+}
+
+// add a line
+func (l *lines) add(line string) {
+	l.list = append(l.list, line)
+	if len(l.list) > l.max {
+		l.list = l.list[1:]
+	}
+}
+
+// String returns lines joined by new line
+func (l *lines) String() string {
+	return strings.Join(l.list, "\n")
+}
@@ -0,0 +1,327 @@
+package sqlmigration
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/Kalinin-Andrey/dbmigrator/internal/domain/migration"
+)
+
+const (
+	// SuffixUp is the suffix of a file with up SQL
+	SuffixUp	= ".up.sql"
+	// SuffixDown is the suffix of a file with down SQL
+	SuffixDown	= ".down.sql"
+)
+
+// PrefixRepeatable is the prefix of a file of a repeatable SQL migration: R__<name>.sql
+const PrefixRepeatable = "R__"
+
+// repeatableNameRegexp matches a file name of a repeatable SQL migration and captures its name
+var repeatableNameRegexp = regexp.MustCompile(`^` + PrefixRepeatable + `([a-zA-Z0-9_-]+)\.sql$`)
+
+// hookNameRegexp matches a file name of a SQL hook: <point>.sql or <point>__<name>.sql, and captures its point
+var hookNameRegexp = regexp.MustCompile(`^(` + strings.Join([]string{migration.HookBeforeAll, migration.HookBeforeEach, migration.HookAfterEach, migration.HookAfterAll, migration.HookOnError}, "|") + `)(__[a-zA-Z0-9_-]+)?\.sql$`)
+
+// fileNameRegexp matches a file name of a SQL migration and captures its ID, name and direction
+var fileNameRegexp = regexp.MustCompile(`^(\d+)_([a-zA-Z0-9_-]+)\.(up|down)\.sql$`)
+
+// DirectiveIdempotent marks a SQL migration as idempotent by the line "-- idempotent" in the header of the up file,
+// a failure of commit of the migration by a dropped connection is retried by the retry policy
+const DirectiveIdempotent = "idempotent"
+
+// DirectiveDependsOn declares migrations that must be applied before a SQL migration by the line "-- depends-on: <id>, <namespace>:<id>"
+// in the header of the up file, an ID without a namespace is of the namespace of the migration
+const DirectiveDependsOn = "depends-on"
+
+// directiveRegexp matches a directive in a comment line of the header of a SQL file: "-- <name>" or "-- <name>: <value>", and captures its name and value
+var directiveRegexp = regexp.MustCompile(`^--\s*(` + DirectiveIdempotent + `|` + DirectiveDependsOn + `)\s*(?::\s*(.*))?$`)
+
+// Dir of SQL migrations
+type Dir struct {
+	Path			string
+}
+
+// FS of SQL migrations, it may be embed.FS, os.DirFS or any other fs.FS
+type FS struct {
+	FS				fs.FS
+	// Path is a directory of migrations in FS, the root of FS by default
+	Path			string
+}
+
+// file of a SQL migration
+type file struct {
+	id			uint
+	name		string
+	direction	string
+	path		string
+}
+
+// Load reads SQL migrations from files of Dir; errors of all files are collected
+func (d Dir) Load() (ms []migration.Migration, errs []error) {
+	return load(os.DirFS(d.Path), ".", d.Path)
+}
+
+// LoadRepeatable reads repeatable SQL migrations from files of Dir; errors of all files are collected
+func (d Dir) LoadRepeatable() (rs []migration.Repeatable, errs []error) {
+	return loadRepeatable(os.DirFS(d.Path), ".", d.Path)
+}
+
+// LoadHooks reads SQL hooks from files of Dir
+func (d Dir) LoadHooks() (hs []migration.Hook, errs []error) {
+	return loadHooks(os.DirFS(d.Path), ".", d.Path)
+}
+
+// Load reads SQL migrations from files of FS; errors of all files are collected
+func (f FS) Load() (ms []migration.Migration, errs []error) {
+	dir := f.dir()
+	return load(f.FS, dir, dir)
+}
+
+// LoadRepeatable reads repeatable SQL migrations from files of FS; errors of all files are collected
+func (f FS) LoadRepeatable() (rs []migration.Repeatable, errs []error) {
+	dir := f.dir()
+	return loadRepeatable(f.FS, dir, dir)
+}
+
+// LoadHooks reads SQL hooks from files of FS
+func (f FS) LoadHooks() (hs []migration.Hook, errs []error) {
+	dir := f.dir()
+	return loadHooks(f.FS, dir, dir)
+}
+
+// dir returns the dir of migrations in FS
+func (f FS) dir() string {
+	if f.Path == "" {
+		return "."
+	}
+	return f.Path
+}
+
+// loadRepeatable reads repeatable SQL migrations from files of the dir in fsys; paths of files in errors are prefixed by the prefix
+func loadRepeatable(fsys fs.FS, dir string, prefix string) (rs []migration.Repeatable, errs []error) {
+	names, err := fs.Glob(fsys, path.Join(dir, PrefixRepeatable + "*.sql"))
+	if err != nil {
+		return nil, []error{errors.Wrapf(err, "Can not read migration dir %q", prefix)}
+	}
+	sort.Strings(names)
+
+	for _, n := range names {
+		filePath := filepath.Join(prefix, path.Base(n))
+		m := repeatableNameRegexp.FindStringSubmatch(path.Base(n))
+		if m == nil {
+			errs = append(errs, errors.Errorf("Invalid name of repeatable SQL migration file %q, expected: %s<name>.sql", filePath, PrefixRepeatable))
+			continue
+		}
+
+		sql, err := fs.ReadFile(fsys, n)
+		if err != nil {
+			errs = append(errs, errors.Wrapf(err, "Can not read SQL migration file %q", filePath))
+			continue
+		}
+
+		rs = append(rs, migration.Repeatable{
+			Name:	m[1],
+			Up:		string(sql),
+			Source:	filePath,
+		})
+	}
+	return rs, errs
+}
+
+// loadHooks reads SQL hooks from files of the dir in fsys in order of names; paths of files in errors are prefixed by the prefix
+func loadHooks(fsys fs.FS, dir string, prefix string) (hs []migration.Hook, errs []error) {
+	names, err := fs.Glob(fsys, path.Join(dir, "*.sql"))
+	if err != nil {
+		return nil, []error{errors.Wrapf(err, "Can not read migration dir %q", prefix)}
+	}
+	sort.Strings(names)
+
+	for _, n := range names {
+		m := hookNameRegexp.FindStringSubmatch(path.Base(n))
+		if m == nil {
+			continue
+		}
+		filePath := filepath.Join(prefix, path.Base(n))
+
+		sql, err := fs.ReadFile(fsys, n)
+		if err != nil {
+			errs = append(errs, errors.Wrapf(err, "Can not read SQL hook file %q", filePath))
+			continue
+		}
+
+		hs = append(hs, migration.Hook{
+			Point:	m[1],
+			Action:	string(sql),
+			Source:	filePath,
+		})
+	}
+	return hs, errs
+}
+
+// load reads SQL migrations from files of the dir in fsys; paths of files in errors are prefixed by the prefix
+func load(fsys fs.FS, dir string, prefix string) (ms []migration.Migration, errs []error) {
+	names, err := fs.Glob(fsys, path.Join(dir, "*.sql"))
+	if err != nil {
+		return nil, []error{errors.Wrapf(err, "Can not read migration dir %q", prefix)}
+	}
+	sort.Strings(names)
+	pairs := make(map[uint]map[string]file)
+
+	for _, n := range names {
+		if strings.HasPrefix(path.Base(n), PrefixRepeatable) || hookNameRegexp.MatchString(path.Base(n)) {
+			continue
+		}
+		f, err := parseFileName(filepath.Join(prefix, path.Base(n)))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		if _, ok := pairs[f.id]; !ok {
+			pairs[f.id] = make(map[string]file, 2)
+		}
+
+		if _, ok := pairs[f.id][f.direction]; ok {
+			errs = append(errs, errors.Errorf("Duplicate %s file of SQL migration #%v: %q", f.direction, f.id, f.path))
+			continue
+		}
+		pairs[f.id][f.direction] = *f
+	}
+
+	for id, pair := range pairs {
+		m, err := loadPair(fsys, dir, id, pair)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		ms = append(ms, *m)
+	}
+	sort.Slice(ms, func(i, j int) bool { return ms[i].ID < ms[j].ID })
+
+	return ms, errs
+}
+
+// parseFileName parses a file name of a SQL migration
+func parseFileName(path string) (*file, error) {
+	m := fileNameRegexp.FindStringSubmatch(filepath.Base(path))
+	if m == nil {
+		return nil, errors.Errorf("Invalid name of SQL migration file %q, expected: <id>_<name>%s or <id>_<name>%s", path, SuffixUp, SuffixDown)
+	}
+
+	id, err := strconv.ParseUint(m[1], 10, 64)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Invalid ID of SQL migration file %q", path)
+	}
+
+	return &file{
+		id:			uint(id),
+		name:		m[2],
+		direction:	m[3],
+		path:		path,
+	}, nil
+}
+
+// loadPair reads up and down files of a SQL migration from the dir in fsys
+func loadPair(fsys fs.FS, dir string, id uint, pair map[string]file) (*migration.Migration, error) {
+	up, okUp := pair["up"]
+	down, okDown := pair["down"]
+
+	switch {
+	case !okUp:
+		return nil, errors.Errorf("Missing up file of SQL migration #%v for %q", id, down.path)
+	case !okDown:
+		return nil, errors.Errorf("Missing down file of SQL migration #%v for %q", id, up.path)
+	case up.name != down.name:
+		return nil, errors.Errorf("Different names of up and down files of SQL migration #%v: %q, %q", id, up.path, down.path)
+	}
+
+	upSQL, err := fs.ReadFile(fsys, path.Join(dir, filepath.Base(up.path)))
+	if err != nil {
+		return nil, errors.Wrapf(err, "Can not read SQL migration file %q", up.path)
+	}
+
+	downSQL, err := fs.ReadFile(fsys, path.Join(dir, filepath.Base(down.path)))
+	if err != nil {
+		return nil, errors.Wrapf(err, "Can not read SQL migration file %q", down.path)
+	}
+
+	ds := directives(string(upSQL))
+	_, idempotent := ds[DirectiveIdempotent]
+
+	dependsOn, err := parseDependencies(ds[DirectiveDependsOn])
+	if err != nil {
+		return nil, errors.Wrapf(err, "Invalid %s directive of SQL migration file %q", DirectiveDependsOn, up.path)
+	}
+
+	return &migration.Migration{
+		ID:			id,
+		Name:		up.name,
+		Up:			string(upSQL),
+		Down:		string(downSQL),
+		Source:		up.path,
+		Idempotent:	idempotent,
+		DependsOn:	dependsOn,
+	}, nil
+}
+
+// parseDependencies parses a comma separated list of dependencies: <id> or <namespace>:<id>
+func parseDependencies(value string) (ds []migration.Dependency, err error) {
+	for _, s := range strings.Split(value, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		namespace, idStr, ok := strings.Cut(s, ":")
+		if !ok {
+			namespace, idStr = "", s
+		}
+
+		id, err := strconv.ParseUint(strings.TrimSpace(idStr), 10, strconv.IntSize)
+		if err != nil {
+			return nil, errors.Errorf("Invalid ID of dependency %q", s)
+		}
+		d := migration.Dependency{
+			Namespace:	strings.TrimSpace(namespace),
+			ID:			uint(id),
+		}
+
+		if err = d.Validate(); err != nil {
+			return nil, errors.Errorf("Invalid dependency %q: %v", s, err)
+		}
+		ds = append(ds, d)
+	}
+	return ds, nil
+}
+
+// directives returns values of directives by names from the header of the SQL, the header is comment and blank lines before the first statement;
+// values of a repeated directive are joined by commas
+func directives(sql string) map[string]string {
+	ds := make(map[string]string)
+
+	for _, line := range strings.Split(sql, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "--") {
+			break
+		}
+		if m := directiveRegexp.FindStringSubmatch(line); m != nil {
+			if v, ok := ds[m[1]]; ok && v != "" {
+				ds[m[1]] = v + ", " + strings.TrimSpace(m[2])
+				continue
+			}
+			ds[m[1]] = strings.TrimSpace(m[2])
+		}
+	}
+	return ds
+}
@@ -20,4 +20,16 @@ var ErrUsersSQL error = errors.New("User's SQL string error")
 var ErrUndefinedTypeOfAction error = errors.New("Undefined type of action")
 // ErrNotInitialised error
 var ErrNotInitialised error = errors.New("SQL Migrator is not initialised")
+// ErrMissing error
+var ErrMissing error = errors.New("Missing migrations")
+// ErrOutOfOrder error
+var ErrOutOfOrder error = errors.New("Out of order migrations")
+// ErrInvalid error
+var ErrInvalid error = errors.New("Invalid migrations")
+// ErrNoTable error
+var ErrNoTable error = errors.New("No history table")
+// ErrDBUnreachable error
+var ErrDBUnreachable error = errors.New("DB is unreachable")
+// ErrLockTimeout error
+var ErrLockTimeout error = errors.New("Lock timeout")
 
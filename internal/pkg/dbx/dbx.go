@@ -1,26 +1,49 @@
 package dbx
 
 import (
-	"fmt"
+	"context"
+	"regexp"
 	"strings"
 	"time"
 
+	"github.com/Kalinin-Andrey/dbmigrator/internal/pkg/apperror"
 	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
 	// pq is the driver for the postgres dialect
 	_ "github.com/lib/pq"
 )
 
 // Configuration for connection to DB
 type Configuration struct {
-	DSN		string
-	Dir		string
-	Dialect	string
+	DSN				string
+	Dir				string
+	Dialect			string
+	// ConnectTimeout is the timeout of connection to DB including all attempts, 10s by default
+	ConnectTimeout	time.Duration
+	// RetryInterval is the interval between attempts of connection, 1s by default
+	RetryInterval	time.Duration
+	// MaxAttempts is the max number of attempts of connection, it is unlimited within the timeout by default
+	MaxAttempts		int
 }
 
 func (c *Configuration) clearQuotes() {
 	c.DSN = strings.Trim(c.DSN, `"`)
 }
 
+// passwordRegexp matches a password in a DSN of key/value form
+var passwordRegexp = regexp.MustCompile(`(password\s*=\s*)('(?:[^'\\]|\\.)*'|[^\s"]+)`)
+// urlPasswordRegexp matches a password in a DSN of URL form
+var urlPasswordRegexp = regexp.MustCompile(`(://[^:/@\s]*:)[^@\s]*@`)
+
+// ScrubDSN replaces the DSN and any passwords of DSN in s
+func ScrubDSN(s string, dsn string) string {
+	if dsn != "" {
+		s = strings.ReplaceAll(s, dsn, "***")
+	}
+	s = passwordRegexp.ReplaceAllString(s, "${1}***")
+	return urlPasswordRegexp.ReplaceAllString(s, "${1}***@")
+}
+
 // DBx is the interface for a DB connection
 type DBx interface {
 	DB() *sqlx.DB
@@ -45,13 +68,15 @@ var _ DBx = (*DB)(nil)
 
 var defaultTimeout = 10 * time.Second
 
-// New creates a new DB connection
+var defaultRetryInterval = 1 * time.Second
+
+// New creates a new DB connection, the timeout overrides the timeout of the configuration if it is not nil
 func New(conf Configuration, timeout *time.Duration) (*DB, error) {
-	if timeout == nil {
-		timeout = &defaultTimeout
+	if timeout != nil {
+		conf.ConnectTimeout = *timeout
 	}
 	conf.clearQuotes()
-	db, err := connectLoop(conf.Dialect, conf.DSN, *timeout)
+	db, err := connectLoop(conf)
 
 	if err != nil {
 		return nil, err
@@ -62,23 +87,40 @@ func New(conf Configuration, timeout *time.Duration) (*DB, error) {
 	return dbobj, nil
 }
 
-// connectLoop is the func for connection in a loop with timeout
-func connectLoop(dialect string, dsn string, timeout time.Duration) (*sqlx.DB, error) {
-	ticker := time.NewTicker(1 * time.Second)
-	defer ticker.Stop()
+// connectLoop is the func for connection in a loop until the timeout is exceeded or the attempts are exhausted, the error contains the last error of connection
+func connectLoop(conf Configuration) (*sqlx.DB, error) {
+	timeout := conf.ConnectTimeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	interval := conf.RetryInterval
+	if interval <= 0 {
+		interval = defaultRetryInterval
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var lastErr error
+	attempt := 0
 
-	timeoutExceeded := time.After(timeout)
 	for {
+		attempt++
+		db, err := sqlx.ConnectContext(ctx, conf.Dialect, conf.DSN)
+		if err == nil {
+			return db, nil
+		}
+		lastErr = err
+
+		if conf.MaxAttempts > 0 && attempt >= conf.MaxAttempts {
+			break
+		}
+
 		select {
-		case <-timeoutExceeded:
-			return nil, fmt.Errorf("DB connection failed after %s timeout", timeout)
-
-		case <-ticker.C:
-			db, err := sqlx.Connect(dialect, dsn)
-			if err == nil {
-				return db, nil
-			}
+		case <-ctx.Done():
+		case <-time.After(interval):
+			continue
 		}
+		break
 	}
+	return nil, errors.Wrapf(apperror.ErrDBUnreachable, "DB connection failed after %v attempts within %s timeout, last error: %v", attempt, timeout, ScrubDSN(lastErr.Error(), conf.DSN))
 }
-
@@ -0,0 +1,107 @@
+package mock
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+
+	"github.com/Kalinin-Andrey/dbmigrator/internal/pkg/dbx"
+)
+
+// Connector is a connector of a fake database/sql driver, it supports transactions only
+type Connector struct {
+	mu				sync.Mutex
+	// CommitErrors are returned by commits of transactions in order, next commits succeed
+	CommitErrors	[]error
+	// Begins is the number of begun transactions
+	Begins			int
+}
+
+var _ driver.Connector = (*Connector)(nil)
+
+// Connect returns a new connection
+func (c *Connector) Connect(ctx context.Context) (driver.Conn, error) {
+	return &conn{connector: c}, nil
+}
+
+// Driver returns the driver of the connector
+func (c *Connector) Driver() driver.Driver {
+	return fakeDriver{connector: c}
+}
+
+// fakeDriver is the driver of Connector
+type fakeDriver struct {
+	connector	*Connector
+}
+
+// Open returns a new connection
+func (d fakeDriver) Open(name string) (driver.Conn, error) {
+	return &conn{connector: d.connector}, nil
+}
+
+// conn is a connection of the fake driver
+type conn struct {
+	connector	*Connector
+}
+
+// Prepare is not supported
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("mock: statements are not supported")
+}
+
+// Close the connection
+func (c *conn) Close() error {
+	return nil
+}
+
+// Begin a transaction
+func (c *conn) Begin() (driver.Tx, error) {
+	c.connector.mu.Lock()
+	defer c.connector.mu.Unlock()
+	c.connector.Begins++
+	return tx{connector: c.connector}, nil
+}
+
+// tx is a transaction of the fake driver
+type tx struct {
+	connector	*Connector
+}
+
+// Commit returns the next error of CommitErrors
+func (t tx) Commit() error {
+	t.connector.mu.Lock()
+	defer t.connector.mu.Unlock()
+
+	if len(t.connector.CommitErrors) == 0 {
+		return nil
+	}
+	err := t.connector.CommitErrors[0]
+	t.connector.CommitErrors = t.connector.CommitErrors[1:]
+	return err
+}
+
+// Rollback the transaction
+func (t tx) Rollback() error {
+	return nil
+}
+
+// DB is a DB connection of the fake driver
+type DB struct {
+	db	*sqlx.DB
+}
+
+var _ dbx.DBx = (*DB)(nil)
+
+// NewDB returns a DB connection of the connector
+func NewDB(c *Connector) *DB {
+	return &DB{db: sqlx.NewDb(sql.OpenDB(c), "postgres")}
+}
+
+// DB returns a db object
+func (db *DB) DB() *sqlx.DB {
+	return db.db
+}
@@ -18,6 +18,9 @@ type Transaction struct {
 // MigrationRepository mock
 type MigrationRepository struct {
 	ExecutionLogs	[]MigrationRepositoryLog
+	RepeatableLogs	map[string]migration.RepeatableLog
+	// SQLErrors are errors returned by ExecSQLTx for SQL texts
+	SQLErrors		map[string]error
 }
 
 // MigrationRepositoryLog struct
@@ -43,6 +46,7 @@ func (t Transaction) Rollback() error {
 func NewMigrationRepository() *MigrationRepository {
 	return &MigrationRepository{
 		ExecutionLogs:	make([]MigrationRepositoryLog, 0, 10),
+		RepeatableLogs:	make(map[string]migration.RepeatableLog),
 	}
 }
 
@@ -61,6 +65,26 @@ func (r *MigrationRepository) SetLogger(logger app.Logger) {
 	})
 }
 
+// SetRetryPolicy mock
+func (r *MigrationRepository) SetRetryPolicy(policy migration.RetryPolicy) {
+	r.ExecutionLogs = append(r.ExecutionLogs, MigrationRepositoryLog{
+		MethodName:	"SetRetryPolicy",
+		Params:		map[string]interface{}{
+			"policy":	policy,
+		},
+	})
+}
+
+// SetNamespace mock
+func (r *MigrationRepository) SetNamespace(namespace string) {
+	r.ExecutionLogs = append(r.ExecutionLogs, MigrationRepositoryLog{
+		MethodName:	"SetNamespace",
+		Params:		map[string]interface{}{
+			"namespace":	namespace,
+		},
+	})
+}
+
 // Query mock
 func (r *MigrationRepository) Query(ctx context.Context, offset, limit uint) ([]migration.Log, error) {
 	r.ExecutionLogs = append(r.ExecutionLogs, MigrationRepositoryLog{
@@ -201,7 +225,7 @@ func (r *MigrationRepository) ExecSQLTx(ctx context.Context, t migration.Transac
 			"sql":		sql,
 		},
 	})
-	return nil
+	return r.SQLErrors[sql]
 }
 
 // ExecFunc mock
@@ -240,6 +264,76 @@ func (r *MigrationRepository) BeginTx(ctx context.Context) (migration.Transactio
 	return Transaction{}, nil
 }
 
+// Session mock, the mock is its own session, the setup is run in a mock transaction
+func (r *MigrationRepository) Session(ctx context.Context, setup migration.SessionSetup) (migration.IRepository, error) {
+	r.ExecutionLogs = append(r.ExecutionLogs, MigrationRepositoryLog{
+		MethodName:	"Session",
+		Params:		map[string]interface{}{
+			"ctx":		ctx,
+		},
+	})
+	if err := setup(ctx, Transaction{}); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Close mock
+func (r *MigrationRepository) Close() error {
+	r.ExecutionLogs = append(r.ExecutionLogs, MigrationRepositoryLog{
+		MethodName:	"Close",
+	})
+	return nil
+}
+
+// IsAppliedTx mock, namespaces are not distinguished
+func (r *MigrationRepository) IsAppliedTx(ctx context.Context, t migration.Transaction, namespace string, id uint) (bool, error) {
+	r.ExecutionLogs = append(r.ExecutionLogs, MigrationRepositoryLog{
+		MethodName:	"IsAppliedTx",
+		Params:		map[string]interface{}{
+			"ctx":			ctx,
+			"t":			t,
+			"namespace":	namespace,
+			"id":			id,
+		},
+	})
+
+	ml, ok := (*fixture.MigrationsLogsList)[id]
+	return ok && ml.Status == migration.StatusApplied, nil
+}
+
+// QueryRepeatable mock
+func (r *MigrationRepository) QueryRepeatable(ctx context.Context) ([]migration.RepeatableLog, error) {
+	r.ExecutionLogs = append(r.ExecutionLogs, MigrationRepositoryLog{
+		MethodName:	"QueryRepeatable",
+		Params:		map[string]interface{}{
+			"ctx":		ctx,
+		},
+	})
+
+	list := make([]migration.RepeatableLog, 0, len(r.RepeatableLogs))
+
+	for _, l := range r.RepeatableLogs {
+		list = append(list, l)
+	}
+	return list, nil
+}
+
+// SaveRepeatableTx mock
+func (r *MigrationRepository) SaveRepeatableTx(ctx context.Context, t migration.Transaction, l *migration.RepeatableLog) error {
+	r.ExecutionLogs = append(r.ExecutionLogs, MigrationRepositoryLog{
+		MethodName:	"SaveRepeatableTx",
+		Params:		map[string]interface{}{
+			"ctx":		ctx,
+			"t":		t,
+			"l":		l,
+		},
+	})
+
+	r.RepeatableLogs[l.Name] = *l
+	return nil
+}
+
 // BatchCreateTx mock
 func (r *MigrationRepository) BatchCreateTx(ctx context.Context, t migration.Transaction, list migration.LogsList) error {
 	r.ExecutionLogs = append(r.ExecutionLogs, MigrationRepositoryLog{
@@ -282,7 +376,23 @@ func (r *MigrationRepository) BatchUpdateTx(ctx context.Context, t migration.Tra
 	return nil
 }
 
+// BatchDeleteTx mock
+func (r *MigrationRepository) BatchDeleteTx(ctx context.Context, t migration.Transaction, list migration.LogsList) error {
+	r.ExecutionLogs = append(r.ExecutionLogs, MigrationRepositoryLog{
+		MethodName:	"BatchDeleteTx",
+		Params:		map[string]interface{}{
+			"ctx":		ctx,
+			"t":		t,
+			"list":		list,
+		},
+	})
 
+	for id := range list {
+		if _, ok := (*fixture.MigrationsLogsList)[id]; !ok {
+			return apperror.ErrNotFound
+		}
+		delete(*fixture.MigrationsLogsList, id)
+	}
 
-
-
+	return nil
+}
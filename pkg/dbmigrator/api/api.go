@@ -1,40 +1,193 @@
 package api
 
 import (
+	"github.com/Kalinin-Andrey/dbmigrator/internal/app"
 	"github.com/Kalinin-Andrey/dbmigrator/internal/domain/migration"
+	"github.com/Kalinin-Andrey/dbmigrator/internal/infrastructure/gomigration"
 	"github.com/Kalinin-Andrey/dbmigrator/internal/pkg/dbx"
 	"github.com/jmoiron/sqlx"
+	"go.opentelemetry.io/otel/trace"
+	"io"
+	"log/slog"
 	"os"
+	"time"
 )
 
+// EnvDSN is the name of the environment variable with DSN for migrations executed as a tool
+const EnvDSN = gomigration.EnvDSN
+
+// ExitCodeNoTable is the exit code of migrations executed as a tool when the history table does not exist
+const ExitCodeNoTable = gomigration.ExitCodeNoTable
+
+// ExitCodeMigrationFailed is the exit code of the command when a migration is failed
+const ExitCodeMigrationFailed = gomigration.ExitCodeMigrationFailed
+
+// ExitCodeDBUnreachable is the exit code of the command when connection to DB is failed within the connect timeout or attempts
+const ExitCodeDBUnreachable = gomigration.ExitCodeDBUnreachable
+
+// ExitCodeLockTimeout is the exit code of the command when a migration is failed by timeout of waiting for a lock
+const ExitCodeLockTimeout = gomigration.ExitCodeLockTimeout
+
+// ExitCodeNotFound is the exit code of migrations executed as a tool when there are no migrations for the action
+const ExitCodeNotFound = gomigration.ExitCodeNotFound
+
+// ExitCodeFuncFailed is the exit code of migrations executed as a tool when a func of a migration is failed
+const ExitCodeFuncFailed = gomigration.ExitCodeFuncFailed
+
 // Logger interface for application
 type Logger interface {
 	Print(v ...interface{})
 	Fatal(v ...interface{})
 }
 
+// NewPrintHandler returns a slog.Handler that writes records as lines "LEVEL message key=value ..." to Print of the logger, records below the level are dropped
+func NewPrintHandler(logger Logger, level slog.Leveler) slog.Handler {
+	return app.NewPrintHandler(logger, level)
+}
+
 // Configuration struct
 type Configuration struct {
-	DSN		string
-	Dir		string
-	Dialect	string
+	DSN				string
+	// Dir is a directory of migrations, it may be empty if migrations are added by dbmigrator.Add or dbmigrator.AddFS
+	Dir				string
+	// Namespace is a set of migrations with an independent sequence of IDs in the shared history table, the default namespace is empty.
+	// SQL files of Dir and Dirs belong to the namespace of the run, migrations added by dbmigrator.Add and dbmigrator.AddFS belong to their own namespaces
+	Namespace		string
+	// Dirs are additional directories of SQL migrations, e.g. shared ones, all migrations are merged into one ordered list
+	Dirs			[]string
+	Dialect			string
+	// ConnectTimeout is the timeout of connection to DB including all attempts, 10s by default
+	ConnectTimeout	time.Duration
+	// RetryInterval is the interval between attempts of connection to DB, 1s by default
+	RetryInterval	time.Duration
+	// MaxAttempts is the max number of attempts of connection to DB, it is unlimited within ConnectTimeout by default
+	MaxAttempts		int
+	// Retry is a policy of retries of transactions of migrations failed by transient errors, retries are off by default
+	Retry			RetryPolicy
+	// IgnoreMissing allows to continue when applied migrations are missing from code
+	IgnoreMissing	bool
+	// OutOfOrder is a policy for migrations older than the last applied one: allow (default), warn or reject
+	OutOfOrder		string
+	// IDScheme is a scheme of allocation of IDs for new migrations: sequence (default) or timestamp
+	IDScheme		string
+	// Templates are files of templates for new migrations
+	Templates		Templates
+	// DisallowGaps forbids gaps between IDs of migrations, it is not compatible with the timestamp ID scheme
+	DisallowGaps	bool
+	// Offline mode does not connect to DB, only Create and Validate are available
+	Offline			bool
+	// ReadOnly mode does not create the history table and does not change DB, only Status and DBVersion are available
+	ReadOnly		bool
+	// CacheDir is a directory for compiled binaries of migrations in the tool mode, the user's cache directory is used by default
+	CacheDir		string
+	// Hooks are run around execution of migrations in order of addition, hooks added by dbmigrator.AddHook and SQL hook files are run before them
+	Hooks			[]Hook
+	// Listeners receive events of execution of migrations, e.g. for progress bars, metrics or audit
+	Listeners		[]Listener
+	// Log is a path to a log file, stdout is used if it is empty
+	Log				string
+	// LogFormat is a format of records of the log: text (default) or json
+	LogFormat		string
+	// LogLevel is the minimal level of records of the log: debug, info (default), warn or error
+	LogLevel		string
+	// Logger is a structured logger with fields migration_id, name, direction and duration, it is used instead of the logger passed to Init and Log if it is set
+	Logger			*slog.Logger
+	// MetricsTextfile is a path to a file for the textfile collector of node_exporter, metrics of migrations are written to it after each run
+	MetricsTextfile	string
+	// TracerProvider provides a tracer for OpenTelemetry spans of runs of migrations and of each migration, migrations are not traced if it is nil
+	TracerProvider	trace.TracerProvider
+	// Events is a writer for events of execution of migrations as JSON lines instead of the logger, it is used by the child process in the tool mode
+	Events			io.Writer
 }
 
+// Templates are paths to files of templates for new migrations, the builtin template is used for an empty path
+type Templates struct {
+	Go			string
+	SQLUp		string
+	SQLDown		string
+}
+
+// RetryPolicy is a policy of retries of transactions of migrations failed by transient errors, e.g. serialization failures, deadlocks or dropped connections.
+// A migration is retried only if it is executed in its own transaction, i.e. without beforeEach and afterEach hooks.
+// A failure of commit by a dropped connection is retried only for idempotent migrations, because the transaction may be committed.
+// SQL file migrations are marked idempotent by the line "-- idempotent" in the header of the up file.
+type RetryPolicy struct {
+	// MaxAttempts is the max number of attempts of execution including the first one, retries are off if it is less than 2
+	MaxAttempts	int
+	// Backoff is the delay before the first retry, it is doubled for each next one, 100ms by default
+	Backoff		time.Duration
+	// Classes are SQLSTATE classes (e.g. "40") or codes (e.g. "40001") of retryable errors, DefaultRetryClasses by default
+	Classes		[]string
+}
+
+// DefaultRetryClasses are SQLSTATE codes of a serialization failure and a deadlock and the class of connection exceptions
+var DefaultRetryClasses = migration.DefaultRetryClasses
+
 // ExpandEnv reads env vars
 func (c *Configuration) ExpandEnv() {
 	c.Dir = os.ExpandEnv(c.Dir)
+	for i := range c.Dirs {
+		c.Dirs[i] = os.ExpandEnv(c.Dirs[i])
+	}
 	c.DSN = os.ExpandEnv(c.DSN)
+	c.CacheDir = os.ExpandEnv(c.CacheDir)
+	c.Log = os.ExpandEnv(c.Log)
+	c.MetricsTextfile = os.ExpandEnv(c.MetricsTextfile)
+	c.Templates.Go = os.ExpandEnv(c.Templates.Go)
+	c.Templates.SQLUp = os.ExpandEnv(c.Templates.SQLUp)
+	c.Templates.SQLDown = os.ExpandEnv(c.Templates.SQLDown)
 }
 
 // DBxConf converts to the dbx configuration
 func (c *Configuration) DBxConf() *dbx.Configuration {
 	return &dbx.Configuration{
-		DSN:     c.DSN,
-		Dir:     c.Dir,
-		Dialect: c.Dialect,
+		DSN:			c.DSN,
+		Dir:			c.Dir,
+		Dialect:		c.Dialect,
+		ConnectTimeout:	c.ConnectTimeout,
+		RetryInterval:	c.RetryInterval,
+		MaxAttempts:	c.MaxAttempts,
+	}
+}
+
+// ServiceOptions converts to the migration service options
+func (c *Configuration) ServiceOptions() *migration.Options {
+	return &migration.Options{
+		OutOfOrder:		c.OutOfOrder,
+		IDScheme:		c.IDScheme,
+		Templates:		migration.Templates(c.Templates),
+		DisallowGaps:	c.DisallowGaps,
+		Hooks:			Hooks(c.Hooks).CoreHooks(),
+		Retry:			migration.RetryPolicy(c.Retry),
+	}
+}
+
+// CoreListeners converts listeners to core listeners
+func (c *Configuration) CoreListeners() migration.Listeners {
+	var listeners migration.Listeners
+
+	for _, l := range c.Listeners {
+		listeners = append(listeners, coreListener{l})
 	}
+	return listeners
 }
 
+const (
+	// LogFormatText - records of the log are lines "time=... level=... msg=... key=value"
+	LogFormatText	= "text"
+	// LogFormatJSON - records of the log are JSON lines
+	LogFormatJSON	= "json"
+)
+
+// LogFormats is slice of log formats
+var LogFormats = []interface{}{LogFormatText, LogFormatJSON}
+
+// OutOfOrderPolicies is slice of out-of-order policies
+var OutOfOrderPolicies = migration.OutOfOrderPolicies
+
+// IDSchemes is slice of ID schemes
+var IDSchemes = migration.IDSchemes
+
 // MigrationTypes is slice of migration types
 var MigrationTypes = []interface{}{migration.MigrationTypeSQL, migration.MigrationTypeGo}
 
@@ -64,6 +217,45 @@ type Migration struct {
 	Name	string
 	Up		interface{}
 	Down	interface{}
+	// Namespace is a set of migrations with an independent sequence of IDs, a migration without a namespace belongs to the default namespace
+	Namespace	string
+	// DependsOn are migrations that must be applied before this one
+	DependsOn	[]Dependency
+	// Idempotent migrations are retried by the retry policy even if it is unknown whether their transaction is committed
+	Idempotent	bool
+}
+
+// Repeatable is a migration that is applied again whenever its checksum changes, e.g. a view, a function or a trigger.
+// Up is a MigrationFunc or a string (plain SQL text), Checksum is computed for SQL and is required for MigrationFunc.
+type Repeatable struct {
+	Name		string
+	Up			interface{}
+	Checksum	string
+	// Namespace of the migration, a migration without a namespace belongs to the default namespace
+	Namespace	string
+}
+
+// CoreRepeatable converts to core repeatable migration
+func (r Repeatable) CoreRepeatable() *migration.Repeatable {
+	up := r.Up
+
+	if act, ok := (r.Up).(MigrationFunc); ok {
+		up = (migration.Func)(act)
+	}
+
+	return &migration.Repeatable{
+		Name:		r.Name,
+		Up:			up,
+		Checksum:	r.Checksum,
+		Namespace:	r.Namespace,
+	}
+}
+
+// Dependency is a migration that must be applied before a dependent one
+type Dependency struct {
+	// Namespace of the migration, the empty namespace is the namespace of the dependent migration
+	Namespace	string
+	ID			uint
 }
 
 // CoreMigration converts to core migration
@@ -80,14 +272,157 @@ func (m Migration) CoreMigration() *migration.Migration {
 		down = (migration.Func)(act)
 	}
 
+	var dependsOn []migration.Dependency
+
+	for _, d := range m.DependsOn {
+		dependsOn = append(dependsOn, migration.Dependency{
+			Namespace:	d.Namespace,
+			ID:			d.ID,
+		})
+	}
+
 	return &migration.Migration{
 		ID:   m.ID,
 		Name: m.Name,
 		Up:   up,
 		Down: down,
+		Namespace:	m.Namespace,
+		DependsOn:	dependsOn,
+		Idempotent:	m.Idempotent,
 	}
 }
 
 // MigrationFunc type
 type MigrationFunc func(tx *sqlx.Tx) error
 
+
+const (
+	// HookBeforeAll - before execution of a batch of migrations, on the connection of the run that executes the migrations, e.g. for SET lock_timeout
+	HookBeforeAll	= migration.HookBeforeAll
+	// HookBeforeEach - before a migration, in the transaction of the migration
+	HookBeforeEach	= migration.HookBeforeEach
+	// HookAfterEach - after a migration, in the transaction of the migration
+	HookAfterEach	= migration.HookAfterEach
+	// HookAfterAll - after successful execution of a batch of migrations and commit of their history log; on a failure migrations stay applied and onError hooks are run
+	HookAfterAll	= migration.HookAfterAll
+	// HookOnError - after a failure of execution of migrations
+	HookOnError		= migration.HookOnError
+)
+
+// HookPoints is slice of the hook points
+var HookPoints = migration.HookPoints
+
+// HookInfo is metadata of execution passed to a hook; ID, Name and Namespace are empty for beforeAll and afterAll hooks
+type HookInfo struct {
+	Point		string
+	Direction	string
+	ID			uint
+	Name		string
+	Namespace	string
+	// Err is the error of execution for onError hooks
+	Err			error
+}
+
+// HookFunc type
+type HookFunc func(tx *sqlx.Tx, info HookInfo) error
+
+// Hook is an action that is run at the hook point: SQL text or Func
+type Hook struct {
+	Point		string
+	SQL			string
+	Func		HookFunc
+	// Source is a file of the hook, it is used in messages of errors
+	Source		string
+}
+
+// Hooks is a slice of Hook
+type Hooks []Hook
+
+// CoreHook converts to core hook
+func (h Hook) CoreHook() *migration.Hook {
+	var action interface{}
+
+	if h.Func != nil {
+		f := h.Func
+		action = migration.HookFunc(func(tx *sqlx.Tx, info migration.HookInfo) error {
+			return f(tx, HookInfo(info))
+		})
+	} else if h.SQL != "" {
+		action = h.SQL
+	}
+
+	return &migration.Hook{
+		Point:	h.Point,
+		Action:	action,
+		Source:	h.Source,
+	}
+}
+
+// CoreHooks converts to core hooks
+func (l Hooks) CoreHooks() migration.Hooks {
+	var hooks migration.Hooks
+
+	for _, h := range l {
+		hooks = append(hooks, *h.CoreHook())
+	}
+	return hooks
+}
+
+const (
+	// EventStarted - execution of a migration is started
+	EventStarted	= migration.EventStarted
+	// EventSucceeded - execution of a migration is finished successfully
+	EventSucceeded	= migration.EventSucceeded
+	// EventFailed - execution of a migration is failed
+	EventFailed		= migration.EventFailed
+	// EventSkipped - a migration is not executed: a repeatable migration is not changed or a previous migration of the run is failed
+	EventSkipped	= migration.EventSkipped
+)
+
+const (
+	// DirectionUp - up action of a migration
+	DirectionUp		= migration.DirectionUp
+	// DirectionDown - down action of a migration
+	DirectionDown	= migration.DirectionDown
+	// DirectionRedo - redo of the last migration, it is passed to beforeAll, afterAll and onError hooks of the run
+	DirectionRedo	= migration.DirectionRedo
+)
+
+// Event of execution of a migration, ID is 0 for repeatable migrations
+type Event struct {
+	Type		string
+	ID			uint
+	Name		string
+	Direction	string
+	// Statements is the number of SQL statements of the action, it is 0 for a MigrationFunc
+	Statements	int
+	// Duration of execution, it is 0 for started and skipped events
+	Duration	time.Duration
+	// Err is the error of a failed event
+	Err			error
+}
+
+// Listener of events of execution of migrations, OnEvent is called synchronously from the goroutine of execution
+type Listener interface {
+	OnEvent(e Event)
+}
+
+// ListenerFunc is a func that is a Listener
+type ListenerFunc func(e Event)
+
+var _ Listener = (ListenerFunc)(nil)
+
+// OnEvent calls the func
+func (f ListenerFunc) OnEvent(e Event) {
+	f(e)
+}
+
+// coreListener adapts a Listener to a core listener
+type coreListener struct {
+	listener	Listener
+}
+
+// OnEvent converts the core event and passes it to the listener
+func (l coreListener) OnEvent(e migration.Event) {
+	l.listener.OnEvent(Event(e))
+}
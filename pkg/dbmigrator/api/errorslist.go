@@ -22,6 +22,18 @@ var ErrUsersSQL error = errors.New("User's SQL string error")
 var ErrUndefinedTypeOfAction error = errors.New("Undefined type of action")
 // ErrNotInitialised error
 var ErrNotInitialised error = errors.New("SQL Migrator is not initialised")
+// ErrMissing is error for case when applied migrations are missing from code
+var ErrMissing error = errors.New("Missing migrations")
+// ErrOutOfOrder is error for case when a migration is older than the last applied one
+var ErrOutOfOrder error = errors.New("Out of order migrations")
+// ErrInvalid is error for case when the set of migrations is invalid
+var ErrInvalid error = errors.New("Invalid migrations")
+// ErrNoTable is error for case when the history table of migrations does not exist
+var ErrNoTable error = errors.New("No history table")
+// ErrDBUnreachable is error for case when connection to DB failed within the connect timeout or attempts
+var ErrDBUnreachable error = errors.New("DB is unreachable")
+// ErrLockTimeout is error for case when a migration is failed by timeout of waiting for a lock
+var ErrLockTimeout error = errors.New("Lock timeout")
 
 // AppErrorConv is a converter from app errors to api errors
 func AppErrorConv(err error) (res error) {
@@ -43,6 +55,18 @@ func AppErrorConv(err error) (res error) {
 		res = errors.Wrapf(ErrUndefinedTypeOfAction, "%v", err.Error())
 	case errors.Is(err, apperror.ErrNotInitialised):
 		res = errors.Wrapf(ErrNotInitialised, "%v", err.Error())
+	case errors.Is(err, apperror.ErrMissing):
+		res = errors.Wrapf(ErrMissing, "%v", err.Error())
+	case errors.Is(err, apperror.ErrOutOfOrder):
+		res = errors.Wrapf(ErrOutOfOrder, "%v", err.Error())
+	case errors.Is(err, apperror.ErrInvalid):
+		res = errors.Wrapf(ErrInvalid, "%v", err.Error())
+	case errors.Is(err, apperror.ErrNoTable):
+		res = errors.Wrapf(ErrNoTable, "%v", err.Error())
+	case errors.Is(err, apperror.ErrDBUnreachable):
+		res = errors.Wrapf(ErrDBUnreachable, "%v", err.Error())
+	case errors.Is(err, apperror.ErrLockTimeout):
+		res = errors.Wrapf(ErrLockTimeout, "%v", err.Error())
 	default:
 		res = err
 	}
@@ -0,0 +1,184 @@
+package dbmigrator
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/Kalinin-Andrey/dbmigrator/pkg/dbmigrator/api"
+)
+
+// HTTPStatus is the response of the status handler
+type HTTPStatus struct {
+	// Version is ID of the last applied migration
+	Version		uint				`json:"version"`
+	Pending		[]PendingMigration	`json:"pending"`
+	// Running is true while migrations are executed
+	Running		bool				`json:"running"`
+	// LastError is the error of the last run of migrations
+	LastError	string				`json:"last_error,omitempty"`
+	// Error is the error of getting of the status
+	Error		string				`json:"error,omitempty"`
+}
+
+// PendingMigration is a migration that is not applied yet
+type PendingMigration struct {
+	ID			uint				`json:"id"`
+	Name		string				`json:"name"`
+}
+
+// StatusTTL is the time the DB status of a migrator is cached by the handlers, the cache is dropped after each run of migrations by the migrator
+const StatusTTL = 10 * time.Second
+
+// runner is a migrator that reports the state of runs of migrations and caches its DB status
+type runner interface {
+	runState() (running bool, lastErr error)
+	cachedStatus() *statusCache
+}
+
+// statusCache is the cached DB status of a migrator,
+// it keeps the handlers from querying DB, or executing the child process in the tool mode, on each request
+type statusCache struct {
+	// mu guards the cache and serialises refreshes, so concurrent requests share one refresh
+	mu			sync.Mutex
+	version		uint
+	pending		[]PendingMigration
+	err			error
+	expires		time.Time
+}
+
+// get returns the cached DB status of the migrator, it is refreshed if it is expired
+func (c *statusCache) get(m IDBMigrator) (version uint, pending []PendingMigration, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if time.Now().Before(c.expires) {
+		return c.version, c.pending, c.err
+	}
+	c.version, c.pending, c.err = queryStatus(m)
+	c.expires = time.Now().Add(StatusTTL)
+	return c.version, c.pending, c.err
+}
+
+// reset drops the cached DB status, it waits for a refresh in progress, so a status got before a change of DB is not kept
+func (c *statusCache) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.expires = time.Time{}
+}
+
+// StatusHandler returns a handler that reports the status of the initialised DBMigrator, it may be registered before Init
+func StatusHandler() http.Handler {
+	return statusHandler(func() IDBMigrator { return dbMigrator })
+}
+
+// NewStatusHandler returns a handler that reports the DB version, pending migrations and the last error of the migrator as JSON.
+// The status is 503 if the migrator is not initialised and 500 if the status can not be got.
+// The DB version and pending migrations are cached for StatusTTL or until the next run of migrations by the migrator.
+func NewStatusHandler(m IDBMigrator) http.Handler {
+	return statusHandler(func() IDBMigrator { return m })
+}
+
+// ReadinessHandler returns a readiness handler of the initialised DBMigrator, it may be registered before Init
+func ReadinessHandler() http.Handler {
+	return readinessHandler(func() IDBMigrator { return dbMigrator })
+}
+
+// NewReadinessHandler returns a handler that responds 200 when all migrations of the migrator are applied,
+// and 503 while the migrator is not initialised, migrations are pending or running or the last run is failed.
+func NewReadinessHandler(m IDBMigrator) http.Handler {
+	return readinessHandler(func() IDBMigrator { return m })
+}
+
+// statusHandler returns the status handler of the migrator that is got on each request
+func statusHandler(instance func() IDBMigrator) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status, err := getStatus(instance())
+		code := http.StatusOK
+
+		if err != nil {
+			status.Error = err.Error()
+			code = http.StatusInternalServerError
+			if errors.Is(err, api.ErrNotInitialised) {
+				code = http.StatusServiceUnavailable
+			}
+		}
+		writeJSON(w, code, status)
+	})
+}
+
+// readinessHandler returns the readiness handler of the migrator that is got on each request
+func readinessHandler(instance func() IDBMigrator) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status, err := getStatus(instance())
+
+		switch {
+		case err != nil:
+			status.Error = err.Error()
+		case status.Running, status.LastError != "", len(status.Pending) > 0:
+		default:
+			writeJSON(w, http.StatusOK, status)
+			return
+		}
+		writeJSON(w, http.StatusServiceUnavailable, status)
+	})
+}
+
+// getStatus returns the status of the migrator, the DB status is cached if the migrator supports it
+func getStatus(m IDBMigrator) (status HTTPStatus, err error) {
+	status.Pending = []PendingMigration{}
+
+	if m == nil || reflect.ValueOf(m).IsNil() {
+		return status, api.ErrNotInitialised
+	}
+
+	r, ok := m.(runner)
+	if !ok {
+		status.Version, status.Pending, err = queryStatus(m)
+		return status, err
+	}
+
+	var lastErr error
+	if status.Running, lastErr = r.runState(); lastErr != nil {
+		status.LastError = lastErr.Error()
+	}
+
+	if status.Running {
+		// DB is changed by the run, it is reported after the run
+		return status, nil
+	}
+	status.Version, status.Pending, err = r.cachedStatus().get(m)
+	return status, err
+}
+
+// queryStatus returns the DB version and pending migrations of the migrator, a missing history table is the version 0
+func queryStatus(m IDBMigrator) (version uint, pending []PendingMigration, err error) {
+	pending = []PendingMigration{}
+
+	version, err = m.DBVersion()
+	if err != nil && !errors.Is(err, api.ErrNoTable) {
+		return version, pending, err
+	}
+
+	plan, err := m.Plan()
+	if err != nil {
+		return version, pending, err
+	}
+
+	for _, l := range plan {
+		pending = append(pending, PendingMigration{ID: l.ID, Name: l.Name})
+	}
+	return version, pending, nil
+}
+
+// writeJSON writes the value as JSON with the status code
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,55 @@
+package dbmigrator
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+
+	"github.com/Kalinin-Andrey/dbmigrator/pkg/dbmigrator/api"
+)
+
+// isLogConfigured returns true if the log is set in the configuration
+func isLogConfigured(config api.Configuration) bool {
+	return config.Log != "" || config.LogFormat != "" || config.LogLevel != ""
+}
+
+// NewLogger returns a slog logger that writes to the log file of the configuration or to stdout, in the format and from the level of the configuration.
+// The log file is appended, its directory is created if it does not exist. The opened log file is returned to be closed by the caller, it is nil for stdout.
+func NewLogger(config api.Configuration) (*slog.Logger, *os.File, error) {
+	level := slog.LevelInfo
+
+	if config.LogLevel != "" {
+		if err := level.UnmarshalText([]byte(config.LogLevel)); err != nil {
+			return nil, nil, errors.Wrapf(api.ErrBadRequest, "Invalid log level %q, expected one of: debug, info, warn, error", config.LogLevel)
+		}
+	}
+
+	var newHandler func(w io.Writer, options *slog.HandlerOptions) slog.Handler
+
+	switch config.LogFormat {
+	case "", api.LogFormatText:
+		newHandler = func(w io.Writer, options *slog.HandlerOptions) slog.Handler { return slog.NewTextHandler(w, options) }
+	case api.LogFormatJSON:
+		newHandler = func(w io.Writer, options *slog.HandlerOptions) slog.Handler { return slog.NewJSONHandler(w, options) }
+	default:
+		return nil, nil, errors.Wrapf(api.ErrBadRequest, "Invalid log format %q, expected one of: %v", config.LogFormat, api.LogFormats)
+	}
+	var w io.Writer = os.Stdout
+	var file *os.File
+
+	if config.Log != "" {
+		if err := os.MkdirAll(filepath.Dir(config.Log), 0755); err != nil {
+			return nil, nil, errors.Wrapf(err, "Can not create a directory of the log file %q", config.Log)
+		}
+
+		f, err := os.OpenFile(config.Log, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "Can not open the log file %q", config.Log)
+		}
+		w, file = f, f
+	}
+	return slog.New(newHandler(w, &slog.HandlerOptions{Level: level})), file, nil
+}
@@ -0,0 +1,214 @@
+package dbmigrator
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/Kalinin-Andrey/dbmigrator/pkg/dbmigrator/api"
+)
+
+// MetricsBuckets are upper bounds in seconds of buckets of histograms of durations of migrations
+var MetricsBuckets = []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60, 300, 600}
+
+// Metrics collects metrics of migrations in the Prometheus text format: the DB version, the number of pending migrations,
+// counters of applied and failed migrations and histograms of durations per migration.
+// Metrics is an api.Listener, it is fed by events of execution of migrations; gauges are refreshed after each run of DBMigrator.
+// Metrics may be served by an HTTP handler or written to a file for the textfile collector of node_exporter.
+type Metrics struct {
+	mu			sync.Mutex
+	namespace	string
+	version		uint
+	pending		int
+	applied		map[string]uint64
+	failed		map[string]uint64
+	durations	map[metricsKey]*histogram
+}
+
+var _ api.Listener = (*Metrics)(nil)
+var _ http.Handler = (*Metrics)(nil)
+
+// metricsKey identifies a histogram of durations of a migration
+type metricsKey struct {
+	id			uint
+	name		string
+	direction	string
+}
+
+// histogram of durations
+type histogram struct {
+	buckets		[]uint64
+	sum			float64
+	count		uint64
+}
+
+// NewMetrics creates new Metrics, the namespace of migrations is a label of all metrics
+func NewMetrics(namespace string) *Metrics {
+	return &Metrics{
+		namespace:	namespace,
+		applied:	make(map[string]uint64),
+		failed:		make(map[string]uint64),
+		durations:	make(map[metricsKey]*histogram),
+	}
+}
+
+// OnEvent counts the event
+func (m *Metrics) OnEvent(e api.Event) {
+	if e.Type != api.EventSucceeded && e.Type != api.EventFailed {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if e.Type == api.EventSucceeded {
+		m.applied[e.Direction]++
+	} else {
+		m.failed[e.Direction]++
+	}
+
+	key := metricsKey{e.ID, e.Name, e.Direction}
+	h, ok := m.durations[key]
+	if !ok {
+		h = &histogram{buckets: make([]uint64, len(MetricsBuckets))}
+		m.durations[key] = h
+	}
+	seconds := e.Duration.Seconds()
+
+	for i, le := range MetricsBuckets {
+		if seconds <= le {
+			h.buckets[i]++
+		}
+	}
+	h.sum += seconds
+	h.count++
+}
+
+// Refresh sets the DB version and the number of pending migrations of the migrator
+func (m *Metrics) Refresh(d IDBMigrator) error {
+	version, err := d.DBVersion()
+	if err != nil {
+		return err
+	}
+
+	plan, err := d.Plan()
+	if err != nil {
+		return err
+	}
+	m.set(version, len(plan))
+	return nil
+}
+
+// set sets the DB version and the number of pending migrations
+func (m *Metrics) set(version uint, pending int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.version	= version
+	m.pending	= pending
+}
+
+// WriteTo writes metrics in the Prometheus text format
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var b bytes.Buffer
+	ns := label("namespace", m.namespace)
+
+	b.WriteString("# HELP dbmigrator_db_version ID of the last applied migration.\n")
+	b.WriteString("# TYPE dbmigrator_db_version gauge\n")
+	fmt.Fprintf(&b, "dbmigrator_db_version{%s} %d\n", ns, m.version)
+
+	b.WriteString("# HELP dbmigrator_pending_migrations Number of migrations that are not applied yet.\n")
+	b.WriteString("# TYPE dbmigrator_pending_migrations gauge\n")
+	fmt.Fprintf(&b, "dbmigrator_pending_migrations{%s} %d\n", ns, m.pending)
+
+	for _, c := range []struct {
+		name, help	string
+		values		map[string]uint64
+	}{
+		{"dbmigrator_migrations_applied_total", "Number of successfully executed migrations.", m.applied},
+		{"dbmigrator_migrations_failed_total", "Number of failed migrations.", m.failed},
+	} {
+		fmt.Fprintf(&b, "# HELP %s %s\n", c.name, c.help)
+		fmt.Fprintf(&b, "# TYPE %s counter\n", c.name)
+
+		for _, direction := range []string{api.DirectionUp, api.DirectionDown} {
+			fmt.Fprintf(&b, "%s{%s,%s} %d\n", c.name, ns, label("direction", direction), c.values[direction])
+		}
+	}
+
+	b.WriteString("# HELP dbmigrator_migration_duration_seconds Duration of execution of a migration.\n")
+	b.WriteString("# TYPE dbmigrator_migration_duration_seconds histogram\n")
+
+	for _, key := range m.keys() {
+		h := m.durations[key]
+		labels := strings.Join([]string{ns, label("migration_id", fmt.Sprint(key.id)), label("name", key.name), label("direction", key.direction)}, ",")
+
+		for i, le := range MetricsBuckets {
+			fmt.Fprintf(&b, "dbmigrator_migration_duration_seconds_bucket{%s,le=\"%g\"} %d\n", labels, le, h.buckets[i])
+		}
+		fmt.Fprintf(&b, "dbmigrator_migration_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, h.count)
+		fmt.Fprintf(&b, "dbmigrator_migration_duration_seconds_sum{%s} %g\n", labels, h.sum)
+		fmt.Fprintf(&b, "dbmigrator_migration_duration_seconds_count{%s} %d\n", labels, h.count)
+	}
+	return b.WriteTo(w)
+}
+
+// keys returns keys of histograms in order of IDs, names and directions
+func (m *Metrics) keys() []metricsKey {
+	keys := make([]metricsKey, 0, len(m.durations))
+
+	for key := range m.durations {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].id != keys[j].id {
+			return keys[i].id < keys[j].id
+		}
+		if keys[i].name != keys[j].name {
+			return keys[i].name < keys[j].name
+		}
+		return keys[i].direction < keys[j].direction
+	})
+	return keys
+}
+
+// ServeHTTP writes metrics in the Prometheus text format
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = m.WriteTo(w)
+}
+
+// WriteTextfile writes metrics to the file for the textfile collector of node_exporter, the file is replaced atomically
+func (m *Metrics) WriteTextfile(path string) error {
+	var b bytes.Buffer
+	if _, err := m.WriteTo(&b); err != nil {
+		return errors.Wrapf(err, "Can not write metrics")
+	}
+
+	tmp := filepath.Join(filepath.Dir(path), "." + filepath.Base(path) + ".tmp")
+	if err := ioutil.WriteFile(tmp, b.Bytes(), 0644); err != nil {
+		return errors.Wrapf(err, "Can not write the metrics file %q", tmp)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return errors.Wrapf(err, "Can not rename the metrics file %q to %q", tmp, path)
+	}
+	return nil
+}
+
+// label returns a label of a metric with the escaped value
+func label(name string, value string) string {
+	value = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+	return fmt.Sprintf("%s=\"%s\"", name, value)
+}
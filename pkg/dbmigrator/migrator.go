@@ -1,20 +1,29 @@
 package dbmigrator
 
 import (
+	"bytes"
 	"context"
-	"fmt"
 	"github.com/pkg/errors"
+	"io"
+	"io/fs"
 	"log"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
 
 	"github.com/Kalinin-Andrey/dbmigrator/pkg/dbmigrator/api"
 
+	"github.com/Kalinin-Andrey/dbmigrator/internal/pkg/apperror"
 	"github.com/Kalinin-Andrey/dbmigrator/internal/pkg/dbx"
 
+	"github.com/Kalinin-Andrey/dbmigrator/internal/app"
 	"github.com/Kalinin-Andrey/dbmigrator/internal/domain/migration"
 	dbrep "github.com/Kalinin-Andrey/dbmigrator/internal/infrastructure/db"
 	"github.com/Kalinin-Andrey/dbmigrator/internal/infrastructure/gomigration"
+	"github.com/Kalinin-Andrey/dbmigrator/internal/infrastructure/sqlmigration"
 )
 
 // Dialect of supported database management system
@@ -25,22 +34,52 @@ type IDBMigrator interface {
 	Up(quantity int) (err error)
 	Down(quantity int) (err error)
 	Redo() (err error)
+	Goto(id uint) (err error)
 	Status() ([]migration.Log, error)
+	Plan() ([]migration.Log, error)
 	DBVersion() (uint, error)
+	Prune() ([]migration.Log, error)
+	Validate() (err error)
+	Graph(wr io.Writer) (err error)
 	Create(p api.MigrationCreateParams) (err error)
+	Close() (err error)
 }
 
 // DBMigrator struct
 type DBMigrator struct {
-	ctx		context.Context
-	config	api.Configuration
-	logger	api.Logger
-	domain	Domain
-	ms		migration.MigrationsList
+	ctx			context.Context
+	config		api.Configuration
+	logger		api.Logger
+	domain		Domain
+	ms			migration.MigrationsList
+	listeners	migration.Listeners
+	summary		*summary
+	events		*gomigration.EventWriter
+	rs			migration.RepeatablesList
+	// instance is the migrator that is used to refresh metrics, it is DBMigratorTool in the tool mode
+	instance	IDBMigrator
+	// metrics are written to the metrics textfile
+	metrics		*Metrics
+	tracing		*tracing
+	// mu guards the state of runs of migrations
+	mu			sync.Mutex
+	running		bool
+	lastErr		error
+	// pending is the number of pending migrations reported by the child process of the last run in the tool mode, it is negative if it is not reported
+	pending		int
+	// status is the DB status cached for the HTTP handlers
+	status		statusCache
+	// logFile is the log file opened by the migrator, it is closed by Close
+	logFile		*os.File
 }
 
-var ms		= make(migration.MigrationsList)
-var errs	= make([]error, 0)
+// namespaces are lists of added migrations by namespaces, migrations without a namespace belong to the default namespace
+var namespaces	= make(map[string]migration.MigrationsList)
+// repeatables are lists of added repeatable migrations by namespaces
+var repeatables	= make(map[string]migration.RepeatablesList)
+// hooks are added hooks and SQL hook files, they are run before hooks of the configuration
+var hooks		[]api.Hook
+var errs		= make([]error, 0)
 
 
 // Domain is a Domain Layer Entry Point
@@ -56,9 +95,105 @@ var dbMigrator IDBMigrator
 // Add method adds a migration to the DBMigrator
 func Add(i api.Migration) {
 	item := i.CoreMigration()
+	// the file of the caller is the source of the migration
+	if _, file, _, ok := runtime.Caller(1); ok {
+		item.Source = file
+	}
+	add(item)
+}
+
+// AddRepeatable method adds a repeatable migration to the DBMigrator
+func AddRepeatable(r api.Repeatable) {
+	item := r.CoreRepeatable()
+	if _, file, _, ok := runtime.Caller(1); ok {
+		item.Source = file
+	}
+	addRepeatable(item)
+}
+
+// AddHook method adds a hook to the DBMigrator
+func AddHook(h api.Hook) {
+	if _, file, _, ok := runtime.Caller(1); ok && h.Source == "" {
+		h.Source = file
+	}
+	hooks = append(hooks, h)
+}
+
+// addHooks adds core SQL hooks to the DBMigrator
+func addHooks(hs []migration.Hook) {
+	for _, h := range hs {
+		sql, _ := h.Action.(string)
+		hooks = append(hooks, api.Hook{
+			Point:	h.Point,
+			SQL:	sql,
+			Source:	h.Source,
+		})
+	}
+}
+
+// AddFS adds SQL migrations from files of the dir in fsys to the DBMigrator, fsys may be embed.FS to ship migrations inside a binary
+func AddFS(fsys fs.FS, dir string) {
+	source := sqlmigration.FS{FS: fsys, Path: dir}
+	list, es := source.Load()
+	errs = append(errs, es...)
+
+	for i := range list {
+		add(&list[i])
+	}
+
+	rs, es := source.LoadRepeatable()
+	errs = append(errs, es...)
+
+	for i := range rs {
+		addRepeatable(&rs[i])
+	}
 
-	if _, ok := ms[item.ID]; ok {
-		errs = append(errs, errors.Wrapf(api.ErrDuplicate, "Duplicate migration ID: %v", item.ID))
+	hs, es := source.LoadHooks()
+	errs = append(errs, es...)
+	addHooks(hs)
+}
+
+// addRepeatable adds a core repeatable migration to the DBMigrator
+func addRepeatable(item *migration.Repeatable) {
+	rs, ok := repeatables[item.Namespace]
+	if !ok {
+		rs = make(migration.RepeatablesList)
+		repeatables[item.Namespace] = rs
+	}
+
+	if r, ok := rs[item.Name]; ok {
+		errs = append(errs, errors.Wrapf(api.ErrDuplicate, "Duplicate repeatable migration %q in %q and %q", item.Name, r.Source, item.Source))
+		return
+	}
+
+	if err := item.Validate(); err != nil {
+		errs = append(errs, errors.Wrapf(err, "Invalid repeatable migration %q", item.Name))
+		return
+	}
+
+	rs[item.Name] = *item
+}
+
+// namespaceRepeatables returns a copy of the list of repeatable migrations of the namespace
+func namespaceRepeatables(namespace string) migration.RepeatablesList {
+	rs := make(migration.RepeatablesList, len(repeatables[namespace]))
+
+	for name, r := range repeatables[namespace] {
+		rs[name] = r
+	}
+	return rs
+}
+
+// add method adds a core migration to the DBMigrator
+func add(item *migration.Migration) {
+	ms, ok := namespaces[item.Namespace]
+	if !ok {
+		ms = make(migration.MigrationsList)
+		namespaces[item.Namespace] = ms
+	}
+
+	if m, ok := ms[item.ID]; ok {
+		errs = append(errs, errors.Wrapf(api.ErrDuplicate, "Duplicate migration ID: %v in %q and %q", item.ID, m.Source, item.Source))
 		return
 	}
 
@@ -70,16 +205,56 @@ func Add(i api.Migration) {
 	ms[item.ID] = *item
 }
 
-// Init initialises DBMigrator instance
-func Init(ctx context.Context, config api.Configuration, logger api.Logger) error {
-	if len(errs) > 0 {
-		return errors.Errorf("DBMigrator.Init errors: \n%v", errs)
+// namespaceMigrations returns a copy of the list of migrations of the namespace
+func namespaceMigrations(namespace string) migration.MigrationsList {
+	ms := make(migration.MigrationsList, len(namespaces[namespace]))
+
+	for id, m := range namespaces[namespace] {
+		ms[id] = m
 	}
+	return ms
+}
 
+// Init initialises DBMigrator instance
+func Init(ctx context.Context, config api.Configuration, logger api.Logger) error {
 	if dbMigrator == nil {
-		dir := gomigration.Dir{Path: config.Dir}
-		if err := dir.Validate(); err != nil {
-			return err
+		if err := migration.ValidateNamespace(config.Namespace); err != nil {
+			return errors.Wrapf(api.ErrBadRequest, "Invalid namespace %q: %v", config.Namespace, err)
+		}
+
+		// the dir is not required when migrations are added by Add or AddFS
+		if config.Dir != "" {
+			dir := gomigration.Dir{Path: config.Dir}
+			if err := dir.Validate(); err != nil {
+				return err
+			}
+			loadSQL(config.Dir, config.Namespace)
+		}
+
+		for _, path := range config.Dirs {
+			dir := gomigration.Dir{Path: path}
+			if err := dir.Validate(); err != nil {
+				return err
+			}
+			loadSQL(path, config.Namespace)
+		}
+		ms := namespaceMigrations(config.Namespace)
+		rs := namespaceRepeatables(config.Namespace)
+		config.Hooks = append(append([]api.Hook{}, hooks...), config.Hooks...)
+
+		if config.Offline {
+			// errors are reported by Validate
+			m, err := NewDBMigrator(ctx, config, logger, nil, ms)
+			if err != nil {
+				return err
+			}
+			m.rs = rs
+			dbMigrator = m
+			return nil
+		}
+
+		if len(errs) > 0 {
+			return errors.Errorf("DBMigrator.Init errors: \n%v", errs)
 		}
 
 		if config.Dialect == "" {
@@ -88,7 +263,7 @@ func Init(ctx context.Context, config api.Configuration, logger api.Logger) erro
 
 		dbx, err := dbx.New(*config.DBxConf(), nil)
 		if err != nil {
-			return err
+			return api.AppErrorConv(err)
 		}
 
 		rep, err := dbrep.GetRepository(dbx, nil, migration.TableName)
@@ -101,42 +276,133 @@ func Init(ctx context.Context, config api.Configuration, logger api.Logger) erro
 			return errors.Errorf("Can not cast DB repository for entity %q to %v.IRepository. Repo: %v", migration.TableName, migration.TableName, rep)
 		}
 
-		dbMigrator, err = NewDBMigrator(ctx, config, logger, repository, ms)
+		m, err := NewDBMigrator(ctx, config, logger, repository, ms)
 		if err != nil {
 			return err
 		}
+		m.rs = rs
+		dbMigrator = m
 	}
 
 	return nil
 }
 
-// NewDBMigrator returns a new instance of DBMigrator
+// loadSQL adds SQL migrations from files of the dir of the run to the DBMigrator, they belong to the namespace of the run
+func loadSQL(path string, namespace string) {
+	dir := sqlmigration.Dir{Path: path}
+	list, es := dir.Load()
+	errs = append(errs, es...)
+
+	for i := range list {
+		list[i].Namespace = namespace
+		add(&list[i])
+	}
+
+	rs, es := dir.LoadRepeatable()
+	errs = append(errs, es...)
+
+	for i := range rs {
+		rs[i].Namespace = namespace
+		addRepeatable(&rs[i])
+	}
+
+	hs, es := dir.LoadHooks()
+	errs = append(errs, es...)
+	addHooks(hs)
+}
+
+// NewDBMigrator returns a new instance of DBMigrator; repository may be nil in the offline mode
 func NewDBMigrator(ctx context.Context, config api.Configuration, logger api.Logger, repository migration.IRepository, ms migration.MigrationsList) (*DBMigrator, error) {
 	if config.Dialect == "" {
 		config.Dialect = Dialect
 	}
 
-	if logger == nil {
+	options := config.ServiceOptions()
+	if err := options.Validate(); err != nil {
+		return nil, errors.Wrapf(api.ErrBadRequest, "Invalid configuration: %v", err)
+	}
+
+	if err := migration.ValidateNamespace(config.Namespace); err != nil {
+		return nil, errors.Wrapf(api.ErrBadRequest, "Invalid namespace %q: %v", config.Namespace, err)
+	}
+
+	var logFile *os.File
+
+	if config.Logger == nil && isLogConfigured(config) {
+		l, f, err := NewLogger(config)
+		if err != nil {
+			return nil, err
+		}
+		config.Logger, logFile = l, f
+	}
+
+	if config.Logger != nil {
+		logger = app.NewSlogLogger(config.Logger)
+	} else if logger == nil {
 		logger = log.New(os.Stdout, "sqlmigrator", log.LstdFlags)
 	}
-	repository.SetLogger(logger)
+
+	var sum *summary
+	var events *gomigration.EventWriter
+	var metrics *Metrics
+
+	if config.MetricsTextfile != "" && config.Events == nil {
+		metrics = NewMetrics(config.Namespace)
+		config.Listeners = append(append([]api.Listener{}, config.Listeners...), metrics)
+	}
+	listeners := config.CoreListeners()
+	var tracing *tracing
+
+	if config.TracerProvider != nil && config.Events == nil {
+		tracing = newTracing(config.TracerProvider, config.Namespace)
+		listeners = append(listeners, tracing)
+	}
+
+	if config.Events != nil {
+		// events are rendered by the parent process
+		events = gomigration.NewEventWriter(config.Events)
+		options.Listeners = append(options.Listeners, events)
+	} else {
+		sum = &summary{}
+		listeners = append(migration.Listeners{migration.NewLogListener(logger), sum}, listeners...)
+	}
+	options.Listeners = append(options.Listeners, listeners...)
 
 	domain := Domain{}
 	domain.Migration.Repository	= repository
-	domain.Migration.Service	= migration.NewService(domain.Migration.Repository, logger)
+	domain.Migration.Service	= migration.NewService(domain.Migration.Repository, logger, *options)
 
-	err := domain.Migration.Service.CreateTable(ctx)
-	if err != nil {
-		return nil, api.AppErrorConv(err)
+	if !config.Offline {
+		repository.SetLogger(logger)
+		repository.SetRetryPolicy(options.Retry)
+		repository.SetNamespace(config.Namespace)
+	}
+
+	if !config.Offline && !config.ReadOnly {
+		err := domain.Migration.Service.CreateTable(ctx)
+		if err != nil {
+			if logFile != nil {
+				logFile.Close()
+			}
+			return nil, api.AppErrorConv(err)
+		}
 	}
 
-	return &DBMigrator{
+	m := &DBMigrator{
 		ctx:    ctx,
 		config: config,
 		logger: logger,
 		domain: domain,
 		ms:		ms,
-	}, nil
+		listeners:	listeners,
+		summary:	sum,
+		events:		events,
+		metrics:	metrics,
+		tracing:	tracing,
+		logFile:	logFile,
+	}
+	m.instance = m
+	return m, nil
 }
 
 // Up migration
@@ -149,7 +415,30 @@ func Up(quantity int) (err error) {
 
 // Up migration
 func (m *DBMigrator) Up(quantity int) (err error) {
-	err = m.domain.Migration.Service.Up(m.ctx, m.ms, quantity)
+	if err = m.checkWritable(); err != nil {
+		return err
+	}
+	if err = m.checkMissing(); err != nil {
+		return err
+	}
+	return m.run(actionUp, func() error {
+		return m.upRepeatable(m.domain.Migration.Service.Up(m.ctx, m.ms, quantity))
+	})
+}
+
+// upRepeatable applies changed repeatable migrations after versioned ones of a successful forward run,
+// there is nothing to apply by the run if neither versioned nor repeatable migrations are applied
+func (m *DBMigrator) upRepeatable(err error) error {
+	if err != nil && !errors.Is(err, apperror.ErrNotFound) {
+		return api.AppErrorConv(err)
+	}
+	count, er := m.domain.Migration.Service.UpRepeatable(m.ctx, m.rs)
+	if er != nil {
+		return api.AppErrorConv(er)
+	}
+	if count > 0 {
+		return nil
+	}
 	return api.AppErrorConv(err)
 }
 
@@ -163,8 +452,15 @@ func Down(quantity int) (err error) {
 
 // Down migration
 func (m *DBMigrator) Down(quantity int) (err error) {
-	err = m.domain.Migration.Service.Down(m.ctx, m.ms, quantity)
-	return api.AppErrorConv(err)
+	if err = m.checkWritable(); err != nil {
+		return err
+	}
+	if err = m.checkMissing(); err != nil {
+		return err
+	}
+	return m.run(actionDown, func() error {
+		return api.AppErrorConv(m.domain.Migration.Service.Down(m.ctx, m.ms, quantity))
+	})
 }
 
 // Redo a one last migration
@@ -177,8 +473,159 @@ func Redo() (err error) {
 
 // Redo a one last migration
 func (m *DBMigrator) Redo() (err error) {
-	err = m.domain.Migration.Service.Redo(m.ctx, m.ms)
-	return api.AppErrorConv(err)
+	if err = m.checkWritable(); err != nil {
+		return err
+	}
+	if err = m.checkMissing(); err != nil {
+		return err
+	}
+	return m.run(actionRedo, func() error {
+		return m.upRepeatable(m.domain.Migration.Service.Redo(m.ctx, m.ms))
+	})
+}
+
+// Goto applies or reverts migrations to make the migration with the ID the last applied one, ID 0 reverts all migrations
+func Goto(id uint) (err error) {
+	if dbMigrator == nil {
+		return api.ErrNotInitialised
+	}
+	return dbMigrator.Goto(id)
+}
+
+// Goto applies or reverts migrations to make the migration with the ID the last applied one, ID 0 reverts all migrations.
+// Goto is not atomic, on a failure the error reports the last applied migration.
+func (m *DBMigrator) Goto(id uint) (err error) {
+	if err = m.checkWritable(); err != nil {
+		return err
+	}
+	if err = m.checkMissing(); err != nil {
+		return err
+	}
+	return m.run(actionGoto, func() error {
+		return m.upRepeatable(m.domain.Migration.Service.Goto(m.ctx, m.ms, id))
+	})
+}
+
+// run executes migrations by the action of the operation, traces it and prints the summary
+func (m *DBMigrator) run(operation string, action func() error) error {
+	// DB may be changed by the run even if it is failed
+	defer m.status.reset()
+
+	if m.summary == nil {
+		err := action()
+		m.writePending()
+		return err
+	}
+	m.summary.reset()
+	m.setRunState(true, nil)
+	m.setPending(-1)
+
+	end := m.tracing.start(m.ctx, operation)
+	err := action()
+	// nothing to execute is not a failure of the run
+	failure := err
+	if errors.Is(err, api.ErrNotFound) {
+		failure = nil
+	}
+	end(failure)
+	m.setRunState(false, failure)
+
+	if m.summary.total() > 0 {
+		app.Slog(m.logger).Info("summary", m.summary.attrs()...)
+	}
+	m.updateMetrics()
+	return err
+}
+
+// setRunState sets the state of runs of migrations
+func (m *DBMigrator) setRunState(running bool, lastErr error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.running	= running
+	m.lastErr	= lastErr
+}
+
+// setPending sets the number of pending migrations reported by the child process
+func (m *DBMigrator) setPending(pending int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.pending = pending
+}
+
+// reportedPending returns the number of pending migrations reported by the child process of the last run, it is negative if it is not reported
+func (m *DBMigrator) reportedPending() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.pending
+}
+
+// writePending writes the number of pending migrations after a run to the events output if it is set,
+// so the parent process refreshes metrics without execution of another child process
+func (m *DBMigrator) writePending() {
+	if m.events == nil {
+		return
+	}
+	plan, err := m.plan()
+	if err != nil {
+		return
+	}
+	m.events.WritePending(len(plan))
+}
+
+// runState returns true while migrations are executed and the error of the last run
+func (m *DBMigrator) runState() (running bool, lastErr error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.running, m.lastErr
+}
+
+// cachedStatus returns the cached DB status of the migrator
+func (m *DBMigrator) cachedStatus() *statusCache {
+	return &m.status
+}
+
+// updateMetrics refreshes metrics listeners and writes the metrics textfile, errors are logged to not fail the run
+func (m *DBMigrator) updateMetrics() {
+	for _, l := range m.config.Listeners {
+		metrics, ok := l.(*Metrics)
+		if !ok {
+			continue
+		}
+
+		if err := m.refreshMetrics(metrics); err != nil {
+			app.Slog(m.logger).Warn("can not refresh metrics", "error", err)
+		}
+	}
+
+	if m.metrics != nil {
+		if err := m.metrics.WriteTextfile(m.config.MetricsTextfile); err != nil {
+			app.Slog(m.logger).Warn("can not write metrics", "error", err)
+		}
+	}
+}
+
+// refreshMetrics refreshes the metrics by the migrator,
+// in the tool mode the number of pending migrations is reported by the child process of the run to not compile and execute another one for the plan
+func (m *DBMigrator) refreshMetrics(metrics *Metrics) error {
+	if mt, ok := m.instance.(*DBMigratorTool); !ok || !mt.hasMainFile() {
+		return metrics.Refresh(m.instance)
+	}
+
+	pending := m.reportedPending()
+	if pending < 0 {
+		return errors.New("the number of pending migrations is not reported by the child process")
+	}
+
+	version, err := m.DBVersion()
+	if err != nil {
+		return err
+	}
+	metrics.set(version, pending)
+	return nil
 }
 
 // Status returns slice of logs of migrations
@@ -190,14 +637,60 @@ func Status() ([]migration.Log, error) {
 	return logs, api.AppErrorConv(err)
 }
 
-// Status returns slice of logs of migrations
+// Status returns slice of logs of migrations saved in DB
 func (m *DBMigrator) Status() ([]migration.Log, error) {
+	if err := m.checkOnline(); err != nil {
+		return nil, err
+	}
 	list, err := m.domain.Migration.Service.List(m.ctx)
 	err = api.AppErrorConv(err)
-	if err != nil && errors.Is(err, api.ErrNotFound) {
-		err = nil
+	if err != nil && !errors.Is(err, api.ErrNotFound) {
+		return nil, err
+	}
+	m.writeLogs(list)
+	return list, nil
+}
+
+// Plan returns slice of logs of migrations that are not applied yet in order of application, changed repeatable migrations with ID 0 are the last
+func Plan() ([]migration.Log, error) {
+	if dbMigrator == nil {
+		return nil, api.ErrNotInitialised
+	}
+	return dbMigrator.Plan()
+}
+
+// Plan returns slice of logs of migrations that are not applied yet in order of application, changed repeatable migrations with ID 0 are the last
+func (m *DBMigrator) Plan() ([]migration.Log, error) {
+	if err := m.checkOnline(); err != nil {
+		return nil, err
+	}
+	plan, err := m.plan()
+	if err != nil {
+		return nil, err
+	}
+	m.writeLogs(plan)
+	return plan, nil
+}
+
+// plan returns logs of migrations that are not applied yet in order of application
+func (m *DBMigrator) plan() ([]migration.Log, error) {
+	plan, err := m.domain.Migration.Service.Plan(m.ctx, m.ms)
+	if err != nil {
+		return nil, api.AppErrorConv(err)
+	}
+	// repeatable migrations are applied after all versioned ones
+	rs, err := m.domain.Migration.Service.PlanRepeatable(m.ctx, m.rs)
+	if err != nil {
+		return nil, api.AppErrorConv(err)
+	}
+	return append(plan, rs...), nil
+}
+
+// writeLogs writes logs to the events output if it is set, so the parent process receives them
+func (m *DBMigrator) writeLogs(list []migration.Log) {
+	if m.events != nil {
+		m.events.WriteLogs(list)
 	}
-	return list, err
 }
 
 // DBVersion returns ID of last applied migration
@@ -210,6 +703,9 @@ func DBVersion() (uint, error) {
 
 // DBVersion returns ID of last applied migration
 func (m *DBMigrator) DBVersion() (uint, error) {
+	if err := m.checkOnline(); err != nil {
+		return 0, err
+	}
 	lm, err := m.domain.Migration.Service.Last(m.ctx)
 	err = api.AppErrorConv(err)
 	if err != nil {
@@ -221,6 +717,116 @@ func (m *DBMigrator) DBVersion() (uint, error) {
 	return lm.ID, nil
 }
 
+// Prune deletes logs of applied migrations that are missing from code
+func Prune() ([]migration.Log, error) {
+	if dbMigrator == nil {
+		return nil, api.ErrNotInitialised
+	}
+	return dbMigrator.Prune()
+}
+
+// Prune deletes logs of applied migrations that are missing from code
+func (m *DBMigrator) Prune() ([]migration.Log, error) {
+	if err := m.checkWritable(); err != nil {
+		return nil, err
+	}
+	defer m.status.reset()
+
+	l, err := m.domain.Migration.Service.Prune(m.ctx, m.ms)
+	if err != nil {
+		return nil, api.AppErrorConv(err)
+	}
+	list := l.Slice()
+	sort.Sort(migration.LogsSlice(list))
+	m.writeLogs(list)
+	return list, nil
+}
+
+// Validate the set of migrations without connection to DB
+func Validate() (err error) {
+	if dbMigrator == nil {
+		return api.ErrNotInitialised
+	}
+	return dbMigrator.Validate()
+}
+
+// Validate the set of migrations without connection to DB, all problems are reported at once
+func (m *DBMigrator) Validate() (err error) {
+	es := append([]error{}, errs...)
+	es = append(es, m.domain.Migration.Service.Validate(m.ctx, m.ms)...)
+
+	if len(es) == 0 {
+		return nil
+	}
+	lines := make([]string, 0, len(es))
+
+	for _, e := range es {
+		lines = append(lines, e.Error())
+	}
+	return errors.Wrapf(api.ErrInvalid, "%v problems found:\n%v", len(es), strings.Join(lines, "\n"))
+}
+
+// Graph writes the dependency graph of migrations in DOT format without connection to DB
+func Graph(wr io.Writer) (err error) {
+	if dbMigrator == nil {
+		return api.ErrNotInitialised
+	}
+	return dbMigrator.Graph(wr)
+}
+
+// Graph writes the dependency graph of migrations in DOT format without connection to DB
+func (m *DBMigrator) Graph(wr io.Writer) (err error) {
+	if m.events == nil {
+		return api.AppErrorConv(m.domain.Migration.Service.Graph(m.ctx, m.ms, wr))
+	}
+	// the graph is passed to the parent process by the events output
+	var buf bytes.Buffer
+	if err = m.domain.Migration.Service.Graph(m.ctx, m.ms, &buf); err != nil {
+		return api.AppErrorConv(err)
+	}
+	m.events.WriteOutput(buf.String())
+	return nil
+}
+
+// checkOnline checks that DBMigrator is connected to DB
+func (m *DBMigrator) checkOnline() error {
+	if m.config.Offline {
+		return errors.Wrapf(api.ErrBadRequest, "DBMigrator is in the offline mode")
+	}
+	return nil
+}
+
+// checkWritable checks that DBMigrator is connected to DB and is allowed to change it
+func (m *DBMigrator) checkWritable() error {
+	if err := m.checkOnline(); err != nil {
+		return err
+	}
+	if m.config.ReadOnly {
+		return errors.Wrapf(api.ErrBadRequest, "DBMigrator is in the read-only mode")
+	}
+	return nil
+}
+
+// checkMissing checks that all migrations saved in DB are represented in code
+func (m *DBMigrator) checkMissing() error {
+	l, err := m.domain.Migration.Service.Missing(m.ctx, m.ms)
+	if err != nil {
+		return api.AppErrorConv(err)
+	}
+
+	if len(l) == 0 {
+		return nil
+	}
+	ids := l.IDs()
+	sort.Ints(ids)
+
+	if m.config.IgnoreMissing {
+		app.Slog(m.logger).Warn("migrations are missing from code and will be ignored", "migration_ids", ids)
+		return nil
+	}
+	return errors.Wrapf(api.ErrMissing, "applied migrations are missing from code: %v; prune them or set IgnoreMissing to continue", ids)
+}
+
 // Create new migration file
 func Create(p api.MigrationCreateParams) (err error) {
 	if dbMigrator == nil {
@@ -232,23 +838,98 @@ func Create(p api.MigrationCreateParams) (err error) {
 // Create new migration file
 func (m *DBMigrator) Create(p api.MigrationCreateParams) (err error) {
 	cp := p.CoreParams()
-	if err = cp.Validate(); err != nil {
+	if err = cp.ValidateDraft(); err != nil {
 		return errors.Wrapf(err, "Invalid create params")
 	}
 
-	if _, ok := m.ms[cp.ID]; ok {
-		return errors.Wrapf(api.ErrBadRequest, "Migration #%v already exists", cp.ID)
+	if m.config.Dir == "" {
+		return errors.Wrapf(api.ErrBadRequest, "Dir is required to create a migration")
+	}
+
+	ids, err := gomigration.Dir{Path: m.config.Dir}.IDs()
+	if err != nil {
+		return err
+	}
+	ids = append(ids, m.ms.IDs()...)
+
+	if cp.ID == 0 {
+		if cp.ID, err = m.domain.Migration.Service.NextID(m.ctx, ids); err != nil {
+			return api.AppErrorConv(err)
+		}
+	}
+
+	for _, id := range ids {
+		if uint(id) == cp.ID {
+			return errors.Wrapf(api.ErrBadRequest, "Migration #%v already exists", cp.ID)
+		}
+	}
+	fileName := filepath.Join(m.config.Dir, m.domain.Migration.Service.FileName(m.ctx, *cp))
+
+	if cp.Type == migration.MigrationTypeSQL {
+		return m.createSQL(fileName, cp)
 	}
-	fileName := fmt.Sprintf("%03d", cp.ID) + "_" + cp.Name +".go"
-	fileName = filepath.Join(m.config.Dir, fileName)
 
-	f, err := os.OpenFile(fileName, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+	f, err := os.OpenFile(fileName + ".go", os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
 	if err != nil {
 		return errors.Wrapf(err, "Error while creating a file")
 	}
-	defer f.Close()
 
 	err = m.domain.Migration.Service.Create(m.ctx, f, *cp)
-	return api.AppErrorConv(err)
+	return api.AppErrorConv(closeCreated(err, f))
 }
 
+// createSQL creates files of up and down SQL for migration
+func (m *DBMigrator) createSQL(fileName string, cp *migration.CreateParams) (err error) {
+	up, err := os.OpenFile(fileName + sqlmigration.SuffixUp, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		return errors.Wrapf(err, "Error while creating a file")
+	}
+
+	down, err := os.OpenFile(fileName + sqlmigration.SuffixDown, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		return closeCreated(errors.Wrapf(err, "Error while creating a file"), up)
+	}
+
+	err = m.domain.Migration.Service.CreateSQL(m.ctx, up, down, *cp)
+	return api.AppErrorConv(closeCreated(err, up, down))
+}
+
+// closeCreated closes the created files of a migration and removes them if the err is not nil or a file can not be closed,
+// a half-written migration or an orphan file of a SQL pair breaks loading of migrations
+func closeCreated(err error, fs ...*os.File) error {
+	for _, f := range fs {
+		if er := f.Close(); er != nil && err == nil {
+			err = errors.Wrapf(er, "Error while closing a file")
+		}
+	}
+	if err == nil {
+		return nil
+	}
+
+	for _, f := range fs {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// Close releases resources of the initialised DBMigrator
+func Close() (err error) {
+	if dbMigrator == nil {
+		return api.ErrNotInitialised
+	}
+	return dbMigrator.Close()
+}
+
+// Close releases resources of the migrator: the log file opened by the migrator is closed
+func (m *DBMigrator) Close() (err error) {
+	if m.logFile == nil {
+		return nil
+	}
+	err = m.logFile.Close()
+	m.logFile = nil
+
+	if err != nil {
+		return errors.Wrapf(err, "Can not close the log file %q", m.config.Log)
+	}
+	return nil
+}
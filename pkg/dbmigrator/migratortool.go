@@ -2,9 +2,12 @@ package dbmigrator
 
 import (
 	"context"
+	"io"
+	"io/ioutil"
 	"github.com/Kalinin-Andrey/dbmigrator/internal/infrastructure/gomigration"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/pkg/errors"
 
@@ -21,6 +24,18 @@ const (
 	actionDown		= "down"
 	// actionRedo const
 	actionRedo		= "redo"
+	// actionPrune const
+	actionPrune		= "prune"
+	// actionValidate const
+	actionValidate	= "validate"
+	// actionStatus const
+	actionStatus	= "status"
+	// actionPlan const
+	actionPlan		= "plan"
+	// actionGoto const
+	actionGoto		= "goto"
+	// actionGraph const
+	actionGraph		= "graph"
 )
 
 // DBMigratorTool is DBMigrator as a tool
@@ -49,39 +64,228 @@ func NewDBMigratorTool(m *DBMigrator) (*DBMigratorTool, error) {
 	}
 	m.domain.Migration.Service = service
 	mt := &DBMigratorTool{m}
+	m.instance = mt
 	return mt, nil
 }
 
 // Up migrations
 func (m *DBMigratorTool) Up(quantity int) (err error) {
-	return m.Exec(actionUp)
+	if !m.hasMainFile() {
+		return m.DBMigrator.Up(quantity)
+	}
+	if err = m.checkWritable(); err != nil {
+		return err
+	}
+	return m.run(actionUp, func() error {
+		return m.Exec(actionUp)
+	})
 }
 
 // Down migrations
 func (m *DBMigratorTool) Down(quantity int) (err error) {
-	return m.Exec(actionDown)
+	if !m.hasMainFile() {
+		return m.DBMigrator.Down(quantity)
+	}
+	if err = m.checkWritable(); err != nil {
+		return err
+	}
+	return m.run(actionDown, func() error {
+		return m.Exec(actionDown)
+	})
 }
 
 // Redo a one last migration
 func (m *DBMigratorTool) Redo() (err error) {
-	return m.Exec(actionRedo)
+	if !m.hasMainFile() {
+		return m.DBMigrator.Redo()
+	}
+	if err = m.checkWritable(); err != nil {
+		return err
+	}
+	return m.run(actionRedo, func() error {
+		return m.Exec(actionRedo)
+	})
+}
+
+// Goto applies or reverts migrations to make the migration with the ID the last applied one, ID 0 reverts all migrations
+func (m *DBMigratorTool) Goto(id uint) (err error) {
+	if !m.hasMainFile() {
+		return m.DBMigrator.Goto(id)
+	}
+	if err = m.checkWritable(); err != nil {
+		return err
+	}
+	return m.run(actionGoto, func() error {
+		a := m.args(actionGoto)
+		a.ID = id
+		return m.exec(a, m.handle)
+	})
+}
+
+// Status returns slice of logs of migrations saved in DB
+func (m *DBMigratorTool) Status() ([]migration.Log, error) {
+	if err := m.checkOnline(); err != nil {
+		return nil, err
+	}
+	if !m.hasMainFile() {
+		return m.DBMigrator.Status()
+	}
+	return m.logs(actionStatus)
+}
+
+// Plan returns slice of logs of migrations that are not applied yet in order of application, changed repeatable migrations with ID 0 are the last
+func (m *DBMigratorTool) Plan() ([]migration.Log, error) {
+	if err := m.checkOnline(); err != nil {
+		return nil, err
+	}
+	if !m.hasMainFile() {
+		return m.DBMigrator.Plan()
+	}
+	return m.logs(actionPlan)
+}
+
+// logs executes the action and returns logs of migrations received from the child process
+func (m *DBMigratorTool) logs(action string) ([]migration.Log, error) {
+	var list []migration.Log
+
+	err := m.exec(m.args(action), func(msg gomigration.Message) {
+		if msg.Event == gomigration.EventLog {
+			list = append(list, msg.CoreLog())
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// Prune logs of applied migrations that are missing from code
+func (m *DBMigratorTool) Prune() ([]migration.Log, error) {
+	if !m.hasMainFile() {
+		return m.DBMigrator.Prune()
+	}
+	if err := m.checkWritable(); err != nil {
+		return nil, err
+	}
+	defer m.status.reset()
+
+	return m.logs(actionPrune)
+}
+
+// Validate the set of migrations without connection to DB
+func (m *DBMigratorTool) Validate() (err error) {
+	if !m.hasMainFile() {
+		return m.DBMigrator.Validate()
+	}
+	return m.Exec(actionValidate)
+}
+
+// Graph writes the dependency graph of migrations in DOT format without connection to DB
+func (m *DBMigratorTool) Graph(wr io.Writer) (err error) {
+	if !m.hasMainFile() {
+		return m.DBMigrator.Graph(wr)
+	}
+	var werr error
+
+	err = m.exec(m.args(actionGraph), func(msg gomigration.Message) {
+		if msg.Event == gomigration.EventOutput && werr == nil {
+			_, werr = io.WriteString(wr, msg.Text + "\n")
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return werr
+}
+
+// Build compiles migrations into the cached binary, that is reused while sources of migrations are not changed
+func Build(force bool) (string, error) {
+	if dbMigrator == nil {
+		return "", api.ErrNotInitialised
+	}
+	mt, ok := dbMigrator.(*DBMigratorTool)
+	if !ok {
+		return "", errors.Wrapf(api.ErrBadRequest, "Build is available only for DBMigrator as a tool")
+	}
+	return mt.Build(force)
+}
+
+// Build compiles migrations into the cached binary, that is reused while sources of migrations are not changed
+func (m *DBMigratorTool) Build(force bool) (string, error) {
+	dir := m.dir()
+	if err := dir.Validate(); err != nil {
+		return "", err
+	}
+	return dir.Build(force)
+}
+
+// dir returns the dir of go migrations
+func (m *DBMigratorTool) dir() gomigration.Dir {
+	return gomigration.Dir{
+		Path:		m.config.Dir,
+		CacheDir:	m.config.CacheDir,
+	}
 }
 
 // Exec migrations
 func (m *DBMigratorTool) Exec(action string) (err error) {
-	dir := gomigration.Dir{
-		Path: m.config.Dir,
-	}
+	return m.exec(m.args(action), m.handle)
+}
+
+// exec runs the child process with the args, messages of the protocol are passed to the handler
+func (m *DBMigratorTool) exec(a gomigration.Args, handler func(msg gomigration.Message)) (err error) {
+	dir := m.dir()
 	if err = dir.Validate(); err != nil {
 		return err
 	}
 
-	output, err := dir.Run(gomigration.Args{
-		DSN:    m.config.DSN,
-		Action: action,
-	})
-	m.logger.Print(output)
-	return err
+	if err = m.checkMainFileVersion(); err != nil {
+		return err
+	}
+
+	return api.AppErrorConv(dir.Run(a, m.logger, handler))
+}
+
+// args returns args of the child process for the action
+func (m *DBMigratorTool) args(action string) gomigration.Args {
+	dirs := make([]string, 0, len(m.config.Dirs))
+
+	for _, d := range m.config.Dirs {
+		// the child process is executed in the dir of migrations
+		if abs, err := filepath.Abs(d); err == nil {
+			d = abs
+		}
+		dirs = append(dirs, d)
+	}
+
+	return gomigration.Args{
+		DSN:			m.config.DSN,
+		Action:			action,
+		IgnoreMissing:	m.config.IgnoreMissing,
+		OutOfOrder:		m.config.OutOfOrder,
+		DisallowGaps:	m.config.DisallowGaps,
+		ReadOnly:		m.config.ReadOnly,
+		Namespace:		m.config.Namespace,
+		Dirs:			dirs,
+		ConnectTimeout:	m.config.ConnectTimeout,
+		RetryInterval:	m.config.RetryInterval,
+		MaxAttempts:	m.config.MaxAttempts,
+		RetryAttempts:	m.config.Retry.MaxAttempts,
+		RetryBackoff:	m.config.Retry.Backoff,
+		RetryClasses:	m.config.Retry.Classes,
+	}
+}
+
+// handle passes events received from the child process to the listeners and saves the number of pending migrations reported by it
+func (m *DBMigratorTool) handle(msg gomigration.Message) {
+	if msg.Event == gomigration.EventPending {
+		m.setPending(msg.Pending)
+		return
+	}
+	if msg.Event == gomigration.EventLog || msg.Event == gomigration.EventOutput {
+		return
+	}
+	m.listeners.OnEvent(msg.CoreEvent())
 }
 
 // Create a migration
@@ -92,6 +296,12 @@ func (m *DBMigratorTool) Create(p api.MigrationCreateParams) (err error) {
 	return m.DBMigrator.Create(p)
 }
 
+// hasMainFile returns true if the main file exists, without it there are no go migrations to compile and commands are executed by DBMigrator
+func (m *DBMigratorTool) hasMainFile() bool {
+	_, err := os.Stat(filepath.Join(m.config.Dir, MainFileName))
+	return err == nil
+}
+
 // checkMainFile checks if main fille exists
 func (m *DBMigratorTool) checkMainFile() (err error) {
 	filePath := filepath.Join(m.config.Dir, MainFileName)
@@ -105,16 +315,32 @@ func (m *DBMigratorTool) checkMainFile() (err error) {
 	return nil
 }
 
+// checkMainFileVersion checks that main file is generated by the current version
+func (m *DBMigratorTool) checkMainFileVersion() (err error) {
+	filePath := filepath.Join(m.config.Dir, MainFileName)
+
+	content, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return errors.Wrapf(err, "Can not read a main file")
+	}
+
+	header, _, _ := strings.Cut(string(content), "\n")
+
+	if strings.TrimSpace(header) != migration.MainFileHeader {
+		return errors.Wrapf(api.ErrBadRequest, "Main file %q is generated by another version, expected header %q, remove it to be regenerated by create command", filePath, migration.MainFileHeader)
+	}
+	return nil
+}
+
 // createMainFile creates main file
 func (m *DBMigratorTool) createMainFile(fileName string) (err error) {
 	f, err := os.OpenFile(fileName, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
 	if err != nil {
 		return errors.Wrapf(err, "Error while creating a main file")
 	}
-	defer f.Close()
 
 	err = m.domain.Migration.Service.CreateMainFile(m.ctx, f)
-	return api.AppErrorConv(err)
+	return api.AppErrorConv(closeCreated(err, f))
 }
 
 
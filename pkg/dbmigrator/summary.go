@@ -0,0 +1,69 @@
+package dbmigrator
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Kalinin-Andrey/dbmigrator/internal/domain/migration"
+)
+
+// summary of execution of migrations
+type summary struct {
+	mu			sync.Mutex
+	finished	int
+	failed		int
+	duration	time.Duration
+}
+
+var _ migration.Listener = (*summary)(nil)
+
+// OnEvent counts the event
+func (s *summary) OnEvent(e migration.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch e.Type {
+	case migration.EventSucceeded:
+		s.finished++
+	case migration.EventFailed:
+		s.failed++
+	default:
+		return
+	}
+	s.duration += e.Duration
+}
+
+// reset counters
+func (s *summary) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.finished	= 0
+	s.failed	= 0
+	s.duration	= 0
+}
+
+// total returns the number of executed migrations
+func (s *summary) total() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.finished + s.failed
+}
+
+// attrs returns the summary as attrs of a log record
+func (s *summary) attrs() []interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return []interface{}{"done", s.finished, "failed", s.failed, "duration", s.duration}
+}
+
+// String returns the summary as a string
+func (s *summary) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return fmt.Sprintf("summary: %v done, %v failed in %v", s.finished, s.failed, s.duration)
+}
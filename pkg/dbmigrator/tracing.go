@@ -0,0 +1,99 @@
+package dbmigrator
+
+import (
+	"context"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/Kalinin-Andrey/dbmigrator/internal/domain/migration"
+)
+
+// TracerName is the name of the tracer of spans of migrations
+const TracerName = "github.com/Kalinin-Andrey/dbmigrator"
+
+// tracing creates a span for each run of migrations and a child span for each migration of the run, spans of migrations are fed by events
+type tracing struct {
+	tracer		trace.Tracer
+	namespace	string
+	mu			sync.Mutex
+	// ctx is the context of the span of the current run
+	ctx			context.Context
+	// span of the current migration
+	span		trace.Span
+}
+
+var _ migration.Listener = (*tracing)(nil)
+
+// newTracing creates a new tracing
+func newTracing(tp trace.TracerProvider, namespace string) *tracing {
+	return &tracing{
+		tracer:		tp.Tracer(TracerName),
+		namespace:	namespace,
+		ctx:		context.Background(),
+	}
+}
+
+// start starts a span of the run of the operation, the returned func ends it with the error of the run; it is no-op for nil tracing
+func (t *tracing) start(ctx context.Context, operation string) func(err error) {
+	if t == nil {
+		return func(err error) {}
+	}
+	ctx, span := t.tracer.Start(ctx, "dbmigrator." + operation, trace.WithAttributes(
+		attribute.String("dbmigrator.namespace", t.namespace),
+	))
+
+	t.mu.Lock()
+	t.ctx = ctx
+	t.mu.Unlock()
+
+	return func(err error) {
+		setError(span, err)
+		span.End()
+
+		t.mu.Lock()
+		t.ctx = context.Background()
+		t.mu.Unlock()
+	}
+}
+
+// OnEvent starts a span of a migration on the started event and ends it on the finished or failed one, skipped migrations are events of the span of the run
+func (t *tracing) OnEvent(e migration.Event) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch e.Type {
+	case migration.EventStarted:
+		_, t.span = t.tracer.Start(t.ctx, "dbmigrator.migration", trace.WithAttributes(eventAttributes(e)...))
+	case migration.EventSucceeded, migration.EventFailed:
+		if t.span == nil {
+			return
+		}
+		setError(t.span, e.Err)
+		t.span.End()
+		t.span = nil
+	case migration.EventSkipped:
+		trace.SpanFromContext(t.ctx).AddEvent("migration skipped", trace.WithAttributes(eventAttributes(e)...))
+	}
+}
+
+// eventAttributes returns attributes of the migration of the event
+func eventAttributes(e migration.Event) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.Int64("migration.id", int64(e.ID)),
+		attribute.String("migration.name", e.Name),
+		attribute.String("migration.direction", e.Direction),
+		attribute.Int("migration.statements", e.Statements),
+	}
+}
+
+// setError records the error in the span and sets the error status
+func setError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}